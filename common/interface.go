@@ -65,12 +65,32 @@ type Type interface { // value type
 
 type Writer[T any] interface {
 	Import([]T)
-	Precommit(bool)
-	Commit(uint64)
-	IsSync() bool // If the writer is synchronous, it will block until the commit is done.
+	Precommit(bool) error    // Errors are returned to the caller instead of panicking, the writer stays usable.
+	Commit(uint64) error     // The writer keeps the buffered data if it fails, so the commit can be retried.
+	RevertGeneration(uint64) // Undo the generation and all the generations precommitted after it.
+	IsSync() bool            // If the writer is synchronous, it will block until the commit is done.
 	Name() string
 }
 
+// WriterStats is optional, implemented by the writers that can report what has been written in the last commit.
+// The stats are reset at the start of each commit, so a failed commit or a detached block reports nothing.
+type WriterStats interface {
+	Written() (uint64, uint64) // The number of transitions and the number of bytes written to the backend.
+}
+
+// WriterSimulator is optional, implemented by the writers that can calculate the root they would have if the pending
+// transitions were committed, without changing their states or touching the backend.
+type WriterSimulator interface {
+	Simulate() ([32]byte, error)
+}
+
+// PipelinedWriter is optional, implemented by the asynchronous writers that can commit a block in the background
+// while the next block is being processed. Detach hands the buffered generations over to a new writer that only
+// commits them, the writer itself is ready for the next block right away.
+type PipelinedWriter[T any] interface {
+	Detach() Writer[T]
+}
+
 type ReadOnlyStore interface {
 	IfExists(string) bool                 // Check if the key exists in the source, which can be a cache or a storage.
 	ReadStorage(string, any) (any, error) // Get from persistent storage.
@@ -76,13 +76,21 @@ func (this Codec) Decode(_ string, buffer []byte, _ any) any {
 	case commutative.UINT256: // delta big int
 		return (&commutative.U256{}).Decode(buffer)
 
+	case commutative.INT256: // delta signed big int
+		return (&commutative.Int256{}).Decode(buffer)
+
+	case commutative.MAX_REGISTER: // max register
+		return (&commutative.MaxRegister{}).Decode(buffer)
+
+	case commutative.MIN_REGISTER: // min register
+		return (&commutative.MinRegister{}).Decode(buffer)
+
 	case noncommutative.INT64:
 		i64 := noncommutative.Int64(0)
 		return i64.Decode(buffer)
 
-		// case commutative.GROWONLY_SET: // GrowOnlySet
-		// 	// panic("GrowOnlySet is not supported in this codec")
-		// 	return (&commutative.GrowOnlySet[[]byte]{}).Decode(buffer)
+	case commutative.GROWONLY_SET: // GrowOnlySet
+		return (&commutative.GrowOnlySet{}).Decode(buffer)
 	}
 
 	// panic("Unknown type ID: " + string(this.ID))
@@ -34,20 +34,36 @@ type StateStore struct {
 	*cache.WriteCache // execution cache, cleared at the end of each block.
 	*committer.StateCommitter
 	backend *proxy.StorageProxy
+	sharded *cache.ShardedWriteCache // The sharded execution cache, nil if it isn't sharded.
 }
 
 // New creates a new StateCommitter instance.
 func NewStateStore(backend *proxy.StorageProxy) *StateStore {
+	return newStateStore(backend, cache.NewWriteCache(
+		backend,
+		16,
+		1,
+		func(k string) uint64 {
+			return xxhash.Sum64String(k)
+		},
+	), nil)
+}
+
+// NewShardedStateStore creates a StateStore with a sharded execution cache for the large blocks. The embedded
+// WriteCache is the first shard, which works as a view of all the shards for the operations on individual
+// paths. The operations on the whole cache need to go through Sharded().
+func NewShardedStateStore(backend *proxy.StorageProxy) *StateStore {
+	sharded := cache.NewShardedWriteCache(backend, 16, 1, func(k string) uint64 {
+		return xxhash.Sum64String(k)
+	})
+	return newStateStore(backend, sharded.Root(), sharded)
+}
+
+func newStateStore(backend *proxy.StorageProxy, writeCache *cache.WriteCache, sharded *cache.ShardedWriteCache) *StateStore {
 	store := &StateStore{
-		backend: backend,
-		WriteCache: cache.NewWriteCache(
-			backend,
-			16,
-			1,
-			func(k string) uint64 {
-				return xxhash.Sum64String(k)
-			},
-		),
+		backend:    backend,
+		WriteCache: writeCache,
+		sharded:    sharded,
 	}
 	store.StateCommitter = committer.NewStateCommitter(store.WriteCache, store.GetWriters())
 
@@ -67,13 +83,41 @@ func NewStateStore(backend *proxy.StorageProxy) *StateStore {
 	return store
 }
 
-func (this *StateStore) Backend() *proxy.StorageProxy    { return this.backend }
-func (this *StateStore) Cache() *cache.WriteCache        { return this.WriteCache }
-func (this *StateStore) Import(trans univalue.Univalues) { this.StateCommitter.Import(trans) }
-func (this *StateStore) Preload(key []byte) any          { return this.backend.Preload(key) }
-func (this *StateStore) Clear()                          { this.WriteCache.Clear() }
+// NewStateStoreWithJournal creates a StateStore whose block commits are recorded in a write-ahead log
+// under the directory first. The block left unfinished by a crash, if any, is replayed before returning,
+// so the store reopens at the returned block number across all the writers.
+func NewStateStoreWithJournal(backend *proxy.StorageProxy, dir string) (*StateStore, uint64, error) {
+	journal, err := committer.NewCommitJournal(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	store := NewStateStore(backend)
+	blockNum, err := store.StateCommitter.SetJournal(journal).Recover()
+	return store, blockNum, err
+}
+
+func (this *StateStore) Backend() *proxy.StorageProxy      { return this.backend }
+func (this *StateStore) Cache() *cache.WriteCache          { return this.WriteCache }
+func (this *StateStore) Import(trans univalue.Univalues)   { this.StateCommitter.Import(trans) }
+func (this *StateStore) Preload(key []byte) any            { return this.backend.Preload(key) }
+func (this *StateStore) Sharded() *cache.ShardedWriteCache { return this.sharded }
+
+func (this *StateStore) Clear() {
+	if this.sharded != nil {
+		this.sharded.Clear()
+		return
+	}
+	this.WriteCache.Clear()
+}
 
 func (this *StateStore) GetWriters() []intf.Writer[*univalue.Univalue] {
+	if this.sharded != nil {
+		return append([]intf.Writer[*univalue.Univalue]{
+			cache.NewShardedCacheWriter(this.sharded, -1)},
+			this.backend.GetWriters()...)
+	}
+
 	return append([]intf.Writer[*univalue.Univalue]{
 		cache.NewExecutionCacheWriter(this.WriteCache, -1)},
 		this.backend.GetWriters()...)
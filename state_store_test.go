@@ -0,0 +1,316 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/storage/cache"
+	committer "github.com/arcology-network/storage-committer/storage/committer"
+	proxy "github.com/arcology-network/storage-committer/storage/proxy"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestShardedStoreRevertGeneration(t *testing.T) {
+	store := NewShardedStateStore(proxy.NewMemDBStoreProxy())
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+
+	store.Import(univalue.Univalues{univalue.NewUnivalue(1, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(1), nil)})
+	if err := store.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Import(univalue.Univalues{
+		univalue.NewUnivalue(2, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(2), nil),
+		univalue.NewUnivalue(2, alice+"0x01", 0, 1, 0, noncommutative.NewInt64(2), nil),
+	})
+	if err := store.Precommit([]uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.Generation() != 2 {
+		t.Fatal("Error: Wrong generation", store.Generation())
+	}
+
+	// Only the second generation is reverted, the first one stays in the shards.
+	if err := store.RevertGeneration(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := store.Sharded().GetIfCached(alice + "0x00"); !ok || *v.(*univalue.Univalue).Value().(*noncommutative.Int64) != 1 {
+		t.Error("Error: The first generation should have been kept", v)
+	}
+
+	if _, ok := store.Sharded().GetIfCached(alice + "0x01"); ok {
+		t.Error("Error: The second generation should have been reverted")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	backend := proxy.NewMemDBStoreProxy()
+	store := NewStateStore(backend)
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+
+	store.Import(univalue.Univalues{univalue.NewUnivalue(1, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(1), nil)})
+	if err := store.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := store.StateCommitter.Commit(1); result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+
+	root, checksum := backend.EthStore().Root(), backend.ExecCache().CacheChecksum()
+	next := func() univalue.Univalues {
+		return univalue.Univalues{
+			univalue.NewUnivalue(2, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(2), nil),
+			univalue.NewUnivalue(2, alice+"0x01", 0, 1, 0, noncommutative.NewInt64(3), nil),
+		}
+	}
+
+	store.Import(next())
+	simulated := store.Simulate([]uint64{2})
+	if simulated.Err() != nil || simulated.EthRoot == root || simulated.EthRoot == [32]byte{} {
+		t.Fatal("Error: Wrong simulated root", simulated.EthRoot, simulated.Err())
+	}
+
+	// Nothing is persisted or cached.
+	if backend.EthStore().Root() != root || backend.ExecCache().CacheChecksum() != checksum || store.Generation() != 0 {
+		t.Error("Error: The simulation shouldn't change the stores")
+	}
+
+	if _, ok := store.Cache().GetIfCached(alice + "0x01"); ok {
+		t.Error("Error: The simulated transitions shouldn't be in the execution cache")
+	}
+
+	// Neither the merge counter, the timings nor the errors of the block are affected.
+	if result := store.StateCommitter.Result(2); len(result.Timings) != 0 || result.MergedSequences != 0 || len(result.Errors) != 0 || result.EthRoot != root {
+		t.Error("Error: The simulation shouldn't show in the result", result.Timings, result.MergedSequences, result.Errors)
+	}
+
+	// The simulated root is the one the block leads to, the transitions need to be imported again.
+	store.Import(next())
+	if err := store.Precommit([]uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := store.StateCommitter.Commit(2); result.Err() != nil || result.EthRoot != simulated.EthRoot {
+		t.Error("Error: The committed root should match the simulated one", result.EthRoot, simulated.EthRoot)
+	}
+}
+
+func TestRevertGenerationWriters(t *testing.T) {
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+	first := func() univalue.Univalues {
+		return univalue.Univalues{univalue.NewUnivalue(1, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(1), nil)}
+	}
+
+	backend := proxy.NewMemDBStoreProxy().EnableCache()
+	store := NewStateStore(backend)
+	store.Import(first())
+	if err := store.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Import(univalue.Univalues{
+		univalue.NewUnivalue(2, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(2), nil),
+		univalue.NewUnivalue(2, alice+"0x01", 0, 1, 0, noncommutative.NewInt64(3), nil),
+	})
+	if err := store.Precommit([]uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RevertGeneration(1); err != nil {
+		t.Fatal(err)
+	}
+
+	result := store.StateCommitter.Commit(1)
+	if result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+
+	// The same block with the first generation only.
+	expected := proxy.NewMemDBStoreProxy().EnableCache()
+	other := NewStateStore(expected)
+	other.Import(first())
+	if err := other.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := other.StateCommitter.Commit(1); result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+
+	if result.EthRoot != expected.EthStore().Root() {
+		t.Error("Error: The reverted generation shouldn't be in the world trie", result.EthRoot, expected.EthStore().Root())
+	}
+
+	if v, ok := backend.ExecCache().Get(alice + "0x00"); !ok || *v.(*noncommutative.Int64) != 1 {
+		t.Error("Error: The live cache should have the value from the first generation", v)
+	}
+
+	if _, ok := backend.ExecCache().Get(alice + "0x01"); ok {
+		t.Error("Error: The reverted generation shouldn't be in the live cache")
+	}
+}
+
+func TestRecoverFromJournal(t *testing.T) {
+	dir := t.TempDir()
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+	block := func() univalue.Univalues {
+		return univalue.Univalues{
+			univalue.NewUnivalue(1, alice+"0x00", 0, 1, 0, noncommutative.NewInt64(1), nil),
+			univalue.NewUnivalue(1, alice+"0x01", 0, 1, 0, noncommutative.NewInt64(2), nil),
+		}
+	}
+
+	store, blockNum, err := NewStateStoreWithJournal(proxy.NewMemDBStoreProxy(), dir)
+	if err != nil || blockNum != 0 {
+		t.Fatal("Error: Failed to open the store", blockNum, err)
+	}
+
+	store.Import(block())
+	if err := store.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crashed after the block was recorded, before the asynchronous writers were done.
+	if err := store.StateCommitter.SyncCommit(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record of the next block torn by the crash.
+	record := filepath.Join(dir, committer.JOURNAL_PENDING_FILE+".1")
+	buffer, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	torn := filepath.Join(dir, committer.JOURNAL_PENDING_FILE+".2")
+	if err := os.WriteFile(torn, buffer[:len(buffer)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing of the block made it to the db.
+	backend := proxy.NewMemDBStoreProxy()
+	recovered, blockNum, err := NewStateStoreWithJournal(backend, dir)
+	if blockNum != 1 || err == nil {
+		t.Fatal("Error: Block 1 should have been replayed and the torn record reported", blockNum, err)
+	}
+
+	for _, file := range []string{record, torn} {
+		if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Error: The record should have been removed", file)
+		}
+	}
+
+	if lastBlock, ok := recovered.Journal().LastBlock(); !ok || lastBlock != 1 {
+		t.Error("Error: Wrong last block in the journal", lastBlock)
+	}
+
+	// The same block committed without a crash.
+	expected := proxy.NewMemDBStoreProxy()
+	other := NewStateStore(expected)
+	other.Import(block())
+	if err := other.Precommit([]uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := other.StateCommitter.Commit(1); result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+
+	if backend.EthStore().Root() != expected.EthStore().Root() {
+		t.Error("Error: The replayed block should lead to the same root", backend.EthStore().Root(), expected.EthStore().Root())
+	}
+}
+
+func TestCascadeDeleteCommitted(t *testing.T) {
+	account := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/"
+	container := account + "storage/container/ctrn/"
+
+	// The transitions of a transaction are written through a cache on top of the store.
+	commit := func(store *StateStore, blockNum, tx uint64, write func(*cache.WriteCache)) {
+		writeCache := cache.NewWriteCache(store, 16, 1)
+		write(writeCache)
+		store.Import(writeCache.Export())
+		if err := store.Precommit([]uint64{tx}); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := store.StateCommitter.Commit(blockNum); result.Err() != nil {
+			t.Fatal(result.Err())
+		}
+	}
+
+	createAccount := func(writeCache *cache.WriteCache) {
+		for _, path := range []string{account, account + "storage/", account + "storage/container/", account + "storage/native/"} {
+			if _, err := writeCache.Write(stgcommon.SYSTEM, path, commutative.NewPath()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	backend := proxy.NewMemDBStoreProxy()
+	store := NewStateStore(backend)
+	commit(store, 1, stgcommon.SYSTEM, createAccount)
+
+	// A container with a nested one.
+	descendants := []string{container + "a", container + "b", container + "sub/", container + "sub/x"}
+	commit(store, 2, 1, func(writeCache *cache.WriteCache) {
+		writeCache.Write(1, container, commutative.NewPath())
+		writeCache.Write(1, container+"a", noncommutative.NewInt64(1))
+		writeCache.Write(1, container+"b", noncommutative.NewInt64(2))
+		writeCache.Write(1, container+"sub/", commutative.NewPath())
+		writeCache.Write(1, container+"sub/x", noncommutative.NewInt64(3))
+	})
+
+	if v, _ := backend.ExecStore().Retrive(container+"sub/x", new(noncommutative.Int64)); v == nil {
+		t.Fatal("Error: The nested element should have been committed")
+	}
+
+	// Only the container is deleted, the descendants go with it.
+	commit(store, 3, 2, func(writeCache *cache.WriteCache) {
+		if _, err := writeCache.Write(2, container, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	for _, path := range append(descendants, container) {
+		if backend.ExecStore().IfExists(path) {
+			t.Error("Error: Should have been deleted from the live storage", path)
+		}
+
+		if backend.EthStore().IfExists(path) {
+			t.Error("Error: Should have been deleted from the eth storage", path)
+		}
+	}
+
+	// The world trie is the same as if the container had never been there.
+	expected := proxy.NewMemDBStoreProxy()
+	commit(NewStateStore(expected), 1, stgcommon.SYSTEM, createAccount)
+	if backend.EthStore().Root() != expected.EthStore().Root() {
+		t.Error("Error: The descendants should have been deleted from the world trie", backend.EthStore().Root(), expected.EthStore().Root())
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	slice "github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	platform "github.com/arcology-network/storage-committer/platform"
+	"github.com/arcology-network/storage-committer/type/univalue"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// warmSet is the EIP-2929 accessed addresses and storage keys of a transaction. The storage keys are
+// kept by their paths, so any path can be warm, including the Arcology containers. In a sharded cache, the warm
+// sets are kept by the first shard along with the snapshot journal.
+type warmSet struct {
+	addrs map[string]struct{}
+	paths map[string]struct{}
+}
+
+// A path or an address becoming warm, to undo when reverting to a snapshot.
+type warmEntry struct {
+	tx     uint64
+	key    string
+	isAddr bool
+}
+
+// EnableAccessTracking starts tracking the warm paths and addresses, for the caches that need the access lists or
+// the warm/cold fees. The tracking is off by default, everything is cold and the accesses cost nothing extra.
+func (this *WriteCache) EnableAccessTracking() *WriteCache {
+	if removals := this.removals(); removals.warm == nil {
+		removals.warm = map[uint64]*warmSet{}
+	}
+	return this
+}
+
+// DisableAccessTracking stops tracking the accesses, everything is cold afterwards.
+func (this *WriteCache) DisableAccessTracking() *WriteCache {
+	this.removals().warm = nil
+	return this
+}
+
+// IsWarm checks if the path has been accessed by the transaction, or prewarmed by its access list.
+func (this *WriteCache) IsWarm(tx uint64, path string) bool {
+	if set, ok := this.removals().warm[tx]; ok {
+		_, ok = set.paths[path]
+		return ok
+	}
+	return false
+}
+
+// IsAddressWarm checks if anything under the account has been accessed by the transaction, or the account
+// has been prewarmed. The address is in the hex format of the paths.
+func (this *WriteCache) IsAddressWarm(tx uint64, addr string) bool {
+	if set, ok := this.removals().warm[tx]; ok {
+		_, ok = set.addrs[strings.ToLower(addr)]
+		return ok
+	}
+	return false
+}
+
+// PrewarmAddresses marks the accounts warm for the transaction, like the sender, the recipient and the precompiles.
+func (this *WriteCache) PrewarmAddresses(tx uint64, addrs ...ethcommon.Address) {
+	for _, addr := range addrs {
+		this.touchAddr(tx, hexutil.Encode(addr[:]))
+	}
+}
+
+// Prewarm marks the addresses and the storage keys in the EIP-2930 access list of the transaction warm.
+func (this *WriteCache) Prewarm(tx uint64, accessList types.AccessList) {
+	for _, tuple := range accessList {
+		addr := hexutil.Encode(tuple.Address[:])
+		this.touchAddr(tx, addr)
+		for _, key := range tuple.StorageKeys {
+			this.touch(tx, stgcommon.ETH10_ACCOUNT_PREFIX+addr+nativeStoragePrefix+hexutil.Encode(key[:]))
+		}
+	}
+}
+
+// Mark the path and its account warm for the transaction, if the accesses are tracked.
+func (this *WriteCache) touch(tx uint64, path string) {
+	if removals := this.removals(); removals.warm != nil {
+		removals.touchPath(tx, path)
+	}
+}
+
+func (this *WriteCache) touchPath(tx uint64, path string) {
+	set := this.warmSetOf(tx)
+	if _, ok := set.paths[path]; !ok {
+		set.paths[path] = struct{}{}
+		this.logWarm(tx, path, false)
+	}
+
+	if len(path) >= stgcommon.ETH10_ACCOUNT_PREFIX_LENGTH+stgcommon.ETH10_ACCOUNT_LENGTH && strings.HasPrefix(path, stgcommon.ETH10_ACCOUNT_PREFIX) {
+		this.touchAddr(tx, platform.GetAccountAddr(path))
+	}
+}
+
+func (this *WriteCache) touchAddr(tx uint64, addr string) {
+	removals := this.removals()
+	if removals.warm == nil {
+		return
+	}
+
+	set := removals.warmSetOf(tx)
+	if _, ok := set.addrs[addr]; !ok {
+		set.addrs[addr] = struct{}{}
+		removals.logWarm(tx, addr, true)
+	}
+}
+
+func (this *WriteCache) warmSetOf(tx uint64) *warmSet {
+	set, ok := this.warm[tx]
+	if !ok {
+		set = &warmSet{addrs: map[string]struct{}{}, paths: map[string]struct{}{}}
+		this.warm[tx] = set
+	}
+	return set
+}
+
+// The accesses are reverted with the call frames, only needed when there are snapshots.
+func (this *WriteCache) logWarm(tx uint64, key string, isAddr bool) {
+	if len(this.journal.snapshots) > 0 {
+		this.journal.warmLog = append(this.journal.warmLog, warmEntry{tx: tx, key: key, isAddr: isAddr})
+	}
+}
+
+// AccessList returns the EIP-2930 access list of the transaction, with all the accounts it has touched, and the
+// native storage keys it has read or written. The sender, the recipient and the precompiles are included if
+// touched, it is up to the caller to remove them for eth_createAccessList.
+func (this *WriteCache) AccessList(tx uint64) types.AccessList {
+	accesses := this.Export()
+	slice.RemoveIf(&accesses, func(_ int, v *univalue.Univalue) bool { return v.GetTx() != tx })
+
+	list := ToAccessList(accesses)
+	if set, ok := this.removals().warm[tx]; ok {
+		listed := map[ethcommon.Address]bool{}
+		for _, tuple := range list {
+			listed[tuple.Address] = true
+		}
+
+		for addr := range set.addrs {
+			if address := ethcommon.HexToAddress(addr); !listed[address] {
+				list = append(list, types.AccessTuple{Address: address, StorageKeys: []ethcommon.Hash{}})
+			}
+		}
+		sortAccessList(list)
+	}
+	return list
+}
+
+// ToAccessList converts the accesses to the native storage into an EIP-2930 access list, grouped by account.
+// Both the reads and the writes are included, the accounts and the keys are sorted.
+func ToAccessList(accesses []*univalue.Univalue) types.AccessList {
+	keys := map[ethcommon.Address]map[ethcommon.Hash]bool{}
+	for _, v := range accesses {
+		if v == nil || v.GetPath() == nil {
+			continue
+		}
+
+		key := platform.GetPathUnder(*v.GetPath(), nativeStoragePrefix)
+		if len(key) == 0 || strings.HasSuffix(key, "/") {
+			continue // Not a native storage slot.
+		}
+
+		addr := ethcommon.HexToAddress(platform.GetAccountAddr(*v.GetPath()))
+		if _, ok := keys[addr]; !ok {
+			keys[addr] = map[ethcommon.Hash]bool{}
+		}
+		keys[addr][ethcommon.HexToHash(key)] = true
+	}
+
+	list := make(types.AccessList, 0, len(keys))
+	for addr, slots := range keys {
+		tuple := types.AccessTuple{Address: addr, StorageKeys: make([]ethcommon.Hash, 0, len(slots))}
+		for slot := range slots {
+			tuple.StorageKeys = append(tuple.StorageKeys, slot)
+		}
+		list = append(list, tuple)
+	}
+	sortAccessList(list)
+	return list
+}
+
+func sortAccessList(list types.AccessList) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Address.Cmp(list[j].Address) < 0 })
+	for _, tuple := range list {
+		sort.Slice(tuple.StorageKeys, func(i, j int) bool { return tuple.StorageKeys[i].Cmp(tuple.StorageKeys[j]) < 0 })
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestToAccessList(t *testing.T) {
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001"
+	bob := "blcc://eth1.0/account/0x0000000000000000000000000000000000000002"
+	key := "0x0000000000000000000000000000000000000000000000000000000000000001"
+
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(1, bob+"/storage/native/"+key, 1, 0, 0, noncommutative.NewInt64(1), nil),
+		univalue.NewUnivalue(1, alice+"/storage/native/"+key, 0, 1, 0, noncommutative.NewInt64(2), nil),
+		univalue.NewUnivalue(1, alice+"/storage/native/"+key, 1, 0, 0, noncommutative.NewInt64(2), nil),
+		univalue.NewUnivalue(1, alice+"/balance", 1, 0, 0, nil, nil),                 // Not a storage slot
+		univalue.NewUnivalue(1, alice+"/storage/container/ctrn/", 1, 0, 0, nil, nil), // Not native
+	}
+
+	list := ToAccessList(accesses)
+	if len(list) != 2 || list[0].Address != ethcommon.HexToAddress("0x01") || list[1].Address != ethcommon.HexToAddress("0x02") {
+		t.Fatal("Error: Wrong accounts", list)
+	}
+
+	if len(list[0].StorageKeys) != 1 || list[0].StorageKeys[0] != ethcommon.HexToHash(key) {
+		t.Error("Error: Wrong storage keys", list[0].StorageKeys)
+	}
+}
+
+func TestWarmSet(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1).EnableAccessTracking()
+	alice := ethcommon.HexToAddress("0x01")
+	slot := ethcommon.HexToHash("0x01")
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/0x0000000000000000000000000000000000000000000000000000000000000001"
+
+	if writeCache.IsWarm(1, path) {
+		t.Error("Error: Should be cold")
+	}
+
+	writeCache.Prewarm(1, types.AccessList{{Address: alice, StorageKeys: []ethcommon.Hash{slot}}})
+	if !writeCache.IsWarm(1, path) || writeCache.IsWarm(2, path) {
+		t.Error("Error: Should be warm for tx 1 only")
+	}
+
+	// Reverted with the snapshot.
+	other := path[:len(path)-1] + "2"
+	id := writeCache.Snapshot()
+	writeCache.Read(1, other, new(noncommutative.Int64))
+	if !writeCache.IsWarm(1, other) {
+		t.Error("Error: Should be warm after the read")
+	}
+
+	writeCache.RevertToSnapshot(id)
+	if writeCache.IsWarm(1, other) || !writeCache.IsWarm(1, path) || !writeCache.IsAddressWarm(1, "0x0000000000000000000000000000000000000001") {
+		t.Error("Error: Only the accesses after the snapshot should be reverted")
+	}
+}
+
+func TestAccessTrackingOptIn(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+	alice := ethcommon.HexToAddress("0x01")
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/0x01"
+
+	writeCache.PrewarmAddresses(1, alice)
+	writeCache.Prewarm(1, types.AccessList{{Address: alice, StorageKeys: []ethcommon.Hash{ethcommon.HexToHash("0x01")}}})
+	writeCache.Read(1, path, new(noncommutative.Int64))
+	if writeCache.warm != nil || writeCache.IsWarm(1, path) || writeCache.IsAddressWarm(1, "0x0000000000000000000000000000000000000001") {
+		t.Error("Error: Nothing should be tracked by default")
+	}
+
+	writeCache.EnableAccessTracking().Read(1, path, new(noncommutative.Int64))
+	if !writeCache.IsWarm(1, path) {
+		t.Error("Error: Should be warm once the tracking is on")
+	}
+
+	if writeCache.DisableAccessTracking().IsWarm(1, path) {
+		t.Error("Error: Should be cold after the tracking is off")
+	}
+}
@@ -17,37 +17,78 @@
 
 package cache
 
+import (
+	"github.com/arcology-network/common-lib/exp/associative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
 // ExecutionCacheWriter is a struct that contains data strucuture and methods for writing data to cache.
 // The indexer is used to index the input transitions as they are received, in a way that they can be
 // isCommitted efficiently later.
 type ExecutionCacheWriter struct {
 	*ExecutionCacheIndexer
 	*WriteCache
+	journal [][]*associative.Pair[string, *univalue.Univalue] // The entries overwritten by each generation, nil if there was none.
+	written uint64                                            // The number of transitions written in the last block.
 }
 
 func NewExecutionCacheWriter(writeCache *WriteCache, version int64) *ExecutionCacheWriter {
 	return &ExecutionCacheWriter{
 		ExecutionCacheIndexer: NewExecutionCacheIndexer(nil, int64(version), nil),
 		WriteCache:            writeCache,
+		journal:               [][]*associative.Pair[string, *univalue.Univalue]{},
 	}
 }
 
 // write cache updates itself every generation. It doesn't need to write to the database.
-func (this *ExecutionCacheWriter) Precommit(isSync bool) {
+// Only the synchronous phase writes to the cache, so a generation is journaled once.
+func (this *ExecutionCacheWriter) Precommit(isSync bool) error {
+	if !isSync {
+		return nil
+	}
 	this.ExecutionCacheIndexer.Finalize() // Remove the nil transitions
+
+	// Keep the overwritten entries, so the generation can be reverted later.
+	overwritten := make([]*associative.Pair[string, *univalue.Univalue], len(this.ExecutionCacheIndexer.buffer))
 	for i := range this.ExecutionCacheIndexer.buffer {
-		this.WriteCache.kvDict[*this.ExecutionCacheIndexer.buffer[i].GetPath()] = this.ExecutionCacheIndexer.buffer[i]
+		path := *this.ExecutionCacheIndexer.buffer[i].GetPath()
+		overwritten[i] = &associative.Pair[string, *univalue.Univalue]{First: path, Second: this.WriteCache.swap(path, this.ExecutionCacheIndexer.buffer[i])}
 	}
+	this.journal = append(this.journal, overwritten)
+	this.WriteCache.publishGeneration(this.ExecutionCacheIndexer.buffer)
 	this.ExecutionCacheIndexer = NewExecutionCacheIndexer(nil, -1, nil)
-
+	return nil
 }
 
 // The generation cache is transient and will clear itself when all the transitions are isCommitted to
 // the database.
-func (this *ExecutionCacheWriter) Commit(_ uint64) {
+func (this *ExecutionCacheWriter) Commit(_ uint64) error {
+	this.written = 0
+	for _, overwritten := range this.journal {
+		this.written += uint64(len(overwritten))
+	}
+
 	this.WriteCache.Clear()
+	this.WriteCache.resetViews()
 	this.ExecutionCacheIndexer.buffer = this.ExecutionCacheIndexer.buffer[:0]
+	this.journal = this.journal[:0]
+	return nil
+}
+
+// RevertGeneration restores the entries overwritten by the generation and all the generations after it.
+// The pending transitions that haven't been precommitted yet are discarded as well.
+func (this *ExecutionCacheWriter) RevertGeneration(gen uint64) {
+	for len(this.journal) > int(gen) {
+		overwritten := this.journal[len(this.journal)-1]
+		for i := len(overwritten) - 1; i >= 0; i-- { // In the reverse order, in case a path was written more than once.
+			this.WriteCache.swap(overwritten[i].First, overwritten[i].Second)
+		}
+		this.journal = this.journal[:len(this.journal)-1]
+	}
+	this.WriteCache.revertViews(gen)
+	this.ExecutionCacheIndexer = NewExecutionCacheIndexer(nil, -1, nil)
 }
 
-func (this *ExecutionCacheWriter) IsSync() bool { return true } // Execution cache is always synchronous.
-func (this *ExecutionCacheWriter) Name() string { return "Execution Cache Writer" }
+func (this *ExecutionCacheWriter) Written() (uint64, uint64) { return this.written, 0 } // Nothing goes to the db.
+func (this *ExecutionCacheWriter) IsSync() bool              { return true }            // Execution cache is always synchronous.
+func (this *ExecutionCacheWriter) Name() string              { return "Execution Cache Writer" }
@@ -17,45 +17,168 @@
 
 package cache
 
-// const (
-// 	READ_NONEXIST          = uint64(3)
-// 	READ_COMMITTED_FROM_DB = uint64(1000) // Read for the state db
-// )
-
-// type Fee struct{}
-
-// func (Fee) Reader(v interface{}) uint64 { // Call this before setting the value attribute to nil
-// 	if v == nil {
-// 		return READ_NONEXIST
-// 	}
-
-// 	typedv := v.(*univalue.Univalue).Value()
-// 	dataSize := common.IfThenDo1st(typedv != nil, func() uint64 { return uint64(typedv.(stgcommon.Type).MemSize()) }, 0)
-// 	return common.IfThen(
-// 		v.(*univalue.Univalue).Reads() > 1, // Is hot loaded
-// 		common.Max(dataSize/32, 1)*3,
-// 		(dataSize/32)*5000,
-// 	)
-// }
-
-// func (Fee) Writer(key string, v interface{}, writecache *WriteCache) int64 { // May get refunds sometimes
-// 	committedSize := uint64(0)
-// 	committedv, _ := writecache.ReadOnlyStore().Retrive(key, v)
-
-// 	if data, ok := committedv.([]byte); ok {
-// 		committedSize = uint64(len(data))
-// 	} else {
-// 		committedSize = common.IfThenDo1st(committedv != nil, func() uint64 { return uint64(committedv.(stgcommon.Type).MemSize()) }, 0)
-// 	}
-
-// 	dataSize := common.IfThenDo1st(v != nil, func() uint64 { return uint64(v.(stgcommon.Type).Size()) }, 0)
-// 	return common.IfThen(
-// 		committedSize > 0,
-// 		common.Max(int64(dataSize/32), 1)*20000,
-// 		common.IfThen(
-// 			int64(dataSize) > int64(committedSize),
-// 			int64(dataSize),
-// 			((int64(committedSize)-int64(dataSize))/32)*20000,
-// 		),
-// 	)
-// }
+import (
+	common "github.com/arcology-network/common-lib/common"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/commutative"
+)
+
+// The container meta operations that are charged on top of the element accesses.
+const (
+	META_LENGTH  uint8 = iota // Length of the container.
+	META_KEY_AT               // Lookups by index or key, IndexOf and KeyAt.
+	META_ORDERED              // Min, Max, LowerBound and UpperBound, which need to scan the container.
+	META_ERASE                // PopBack, EraseRange and the wildcard deletes.
+)
+
+// Access describes the state of an entry before it is accessed by a transaction.
+type Access struct {
+	Warm     bool   // Accessed by the same transaction before.
+	Dirty    bool   // Written by the same transaction before.
+	Existed  bool   // In the committed state.
+	DataSize uint64 // Size of the value in bytes.
+}
+
+// FeeSchedule turns the state accesses into gas, so all the execution engines charge identically.
+type FeeSchedule interface {
+	ReadFee(Access) uint64
+	WriteFee(Access, bool) (uint64, uint64) // The fee and the refund, the flag is for deletions.
+	MetaFee(uint8, Access, uint64) uint64   // The operation, the access to the container meta and the container length.
+}
+
+// EthFeeSchedule charges like Ethereum, EIP-2929 for the cold and warm accesses and EIP-2200 for the storage writes.
+// The refunds follow EIP-3529.
+type EthFeeSchedule struct {
+	ColdRead    uint64 // The first access in a transaction
+	WarmRead    uint64 // Any access after the first one
+	NewSlot     uint64 // Write to an entry that isn't in the committed state
+	Update      uint64 // Update or delete a committed entry
+	ClearRefund uint64 // Delete a committed entry
+}
+
+func NewEthFeeSchedule() *EthFeeSchedule {
+	return &EthFeeSchedule{
+		ColdRead:    2100,
+		WarmRead:    100,
+		NewSlot:     20000,
+		Update:      2900,
+		ClearRefund: 4800,
+	}
+}
+
+func (this *EthFeeSchedule) ReadFee(access Access) uint64 {
+	return common.IfThen(access.Warm, this.WarmRead, this.ColdRead)
+}
+
+func (this *EthFeeSchedule) WriteFee(access Access, deleting bool) (uint64, uint64) {
+	fee := common.IfThen(access.Warm, uint64(0), this.ColdRead) // The cold access surcharge.
+	switch {
+	case access.Dirty: // Already paid for by the first write in the transaction.
+		return fee + this.WarmRead, 0
+
+	case !access.Existed: // Deleting a non-existent entry changes nothing.
+		return fee + common.IfThen(deleting, this.WarmRead, this.NewSlot), 0
+
+	default:
+		return fee + this.Update, common.IfThen(deleting, this.ClearRefund, uint64(0))
+	}
+}
+
+// There are no containers in Ethereum, a meta operation is charged as a read.
+func (this *EthFeeSchedule) MetaFee(_ uint8, access Access, _ uint64) uint64 {
+	return this.ReadFee(access)
+}
+
+// ContainerFeeSchedule charges the Arcology containers. The entries are charged by 32-byte words on top of the
+// Ethereum schedule, so a single-word entry costs the same as an Ethereum storage slot. The operations scanning
+// the containers are charged by their lengths as well.
+type ContainerFeeSchedule struct {
+	*EthFeeSchedule
+	PerElement uint64 // For every element scanned by a meta operation.
+}
+
+func NewContainerFeeSchedule() *ContainerFeeSchedule {
+	return &ContainerFeeSchedule{
+		EthFeeSchedule: NewEthFeeSchedule(),
+		PerElement:     3,
+	}
+}
+
+func (this *ContainerFeeSchedule) ReadFee(access Access) uint64 {
+	return this.EthFeeSchedule.ReadFee(access) * words(access.DataSize)
+}
+
+func (this *ContainerFeeSchedule) WriteFee(access Access, deleting bool) (uint64, uint64) {
+	fee, refund := this.EthFeeSchedule.WriteFee(access, deleting)
+	return fee * words(access.DataSize), refund * words(access.DataSize)
+}
+
+func (this *ContainerFeeSchedule) MetaFee(op uint8, access Access, length uint64) uint64 {
+	fee := this.EthFeeSchedule.ReadFee(access) // Only the meta is read, not the elements.
+	if op == META_ORDERED || op == META_ERASE {
+		fee += this.PerElement * length
+	}
+	return fee
+}
+
+// The number of 32-byte words, at least one.
+func words(dataSize uint64) uint64 {
+	return common.Max((dataSize+31)/32, 1)
+}
+
+// SetFeeSchedule replaces the fee schedule of the cache, the default is the Ethereum schedule.
+func (this *WriteCache) SetFeeSchedule(fees FeeSchedule) *WriteCache {
+	this.fees = fees
+	return this
+}
+
+func (this *WriteCache) FeeSchedule() FeeSchedule { return this.fees }
+
+// The state of an entry before the transaction accesses it.
+func (this *WriteCache) access(tx uint64, path string) Access {
+	access := Access{Warm: this.IsWarm(tx, path), DataSize: stgcommon.MIN_READ_SIZE}
+	univ, ok := this.cached(path)
+	if !ok || univ.GetTx() != tx {
+		access.Existed = this.backend != nil && !this.RemovedWithAncestor(path) && this.backend.IfExists(path)
+		return access
+	}
+
+	access.Dirty = !univ.IsReadOnly()
+	access.Existed = univ.IsCommitted()
+	if typedv := univ.Value(); typedv != nil {
+		access.DataSize = typedv.(stgcommon.Type).MemSize()
+	}
+	return access
+}
+
+// ReadWithFee reads the value like Read, but returns the fee instead of the data size.
+func (this *WriteCache) ReadWithFee(tx uint64, path string, T any) (any, uint64) {
+	access := this.access(tx, path)
+	v, _, dataSize := this.Read(tx, path, T)
+	access.DataSize = dataSize
+	return v, this.fees.ReadFee(access)
+}
+
+// WriteWithFee writes the value like Write, but returns the fee and the refund instead of the data size difference.
+func (this *WriteCache) WriteWithFee(tx uint64, path string, newVal any) (uint64, uint64, error) {
+	access := this.access(tx, path)
+	if newVal != nil {
+		access.DataSize = common.Max(access.DataSize, newVal.(stgcommon.Type).MemSize())
+	}
+
+	_, err := this.Write(tx, path, newVal)
+	fee, refund := this.fees.WriteFee(access, newVal == nil)
+	return fee, refund, err
+}
+
+// MetaFee returns the fee of a meta operation on a container, on top of the fees of the element accesses.
+func (this *WriteCache) MetaFee(tx uint64, path string, op uint8) uint64 {
+	access := this.access(tx, path)
+	length := uint64(0)
+	if meta, _, _ := this.FindForRead(tx, path, new(commutative.Path), nil); meta != nil {
+		if meta, ok := meta.(*commutative.Path); ok {
+			length = uint64(meta.Length())
+		}
+	}
+	return this.fees.MetaFee(op, access, length)
+}
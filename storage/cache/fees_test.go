@@ -0,0 +1,125 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+)
+
+func TestEthFeeSchedule(t *testing.T) {
+	fees := NewEthFeeSchedule()
+	if fee := fees.ReadFee(Access{}); fee != 2100 {
+		t.Error("Error: Wrong cold read fee", fee)
+	}
+
+	if fee := fees.ReadFee(Access{Warm: true}); fee != 100 {
+		t.Error("Error: Wrong warm read fee", fee)
+	}
+
+	if fee, refund := fees.WriteFee(Access{}, false); fee != 22100 || refund != 0 {
+		t.Error("Error: Wrong new slot fee", fee, refund)
+	}
+
+	if fee, refund := fees.WriteFee(Access{Warm: true, Existed: true}, false); fee != 2900 || refund != 0 {
+		t.Error("Error: Wrong update fee", fee, refund)
+	}
+
+	if fee, refund := fees.WriteFee(Access{Warm: true, Existed: true}, true); fee != 2900 || refund != 4800 {
+		t.Error("Error: Wrong delete fee", fee, refund)
+	}
+
+	if fee, refund := fees.WriteFee(Access{Warm: true, Dirty: true, Existed: true}, false); fee != 100 || refund != 0 {
+		t.Error("Error: Wrong dirty write fee", fee, refund)
+	}
+}
+
+func TestContainerFeeSchedule(t *testing.T) {
+	fees := NewContainerFeeSchedule()
+	if fee := fees.ReadFee(Access{DataSize: 32}); fee != NewEthFeeSchedule().ReadFee(Access{}) {
+		t.Error("Error: A single word should cost the same as a storage slot", fee)
+	}
+
+	if fee := fees.ReadFee(Access{Warm: true, DataSize: 65}); fee != 300 {
+		t.Error("Error: Wrong multi-word read fee", fee)
+	}
+
+	if fee := fees.MetaFee(META_LENGTH, Access{Warm: true}, 100); fee != 100 {
+		t.Error("Error: Wrong length fee", fee)
+	}
+
+	if fee := fees.MetaFee(META_ORDERED, Access{Warm: true}, 100); fee != 400 {
+		t.Error("Error: Wrong ordered fee", fee)
+	}
+}
+
+func TestFeesThroughCache(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1).EnableAccessTracking()
+	if _, ok := writeCache.FeeSchedule().(*EthFeeSchedule); !ok {
+		t.Fatal("Error: The Ethereum schedule should be the default")
+	}
+
+	// Cold first, then warm.
+	if v, fee := writeCache.ReadWithFee(1, path+"a", new(noncommutative.Int64)); v == nil || fee != 2100 {
+		t.Error("Error: Wrong cold read fee", v, fee)
+	}
+
+	if _, fee := writeCache.ReadWithFee(1, path+"a", new(noncommutative.Int64)); fee != 100 {
+		t.Error("Error: Wrong warm read fee", fee)
+	}
+
+	if fee, refund, err := writeCache.WriteWithFee(1, path+"b", noncommutative.NewInt64(5)); err != nil || fee != 5000 || refund != 0 {
+		t.Error("Error: Wrong cold update fee", fee, refund, err)
+	}
+
+	if fee, _, err := writeCache.WriteWithFee(1, path+"b", noncommutative.NewInt64(6)); err != nil || fee != 100 {
+		t.Error("Error: Wrong dirty write fee", fee, err)
+	}
+
+	if fee, _, err := writeCache.WriteWithFee(1, path+"c", noncommutative.NewInt64(3)); err != nil || fee != 22100 {
+		t.Error("Error: Wrong new slot fee", fee, err)
+	}
+
+	if fee, refund, err := writeCache.WriteWithFee(1, path+"a", nil); err != nil || fee != 2900 || refund != 4800 {
+		t.Error("Error: Wrong delete fee", fee, refund, err)
+	}
+
+	// The warm set is per transaction.
+	if _, fee := writeCache.ReadWithFee(2, path+"b", new(noncommutative.Int64)); fee != 2100 {
+		t.Error("Error: Should be cold for another transaction", fee)
+	}
+
+	// Charged as a read of the meta.
+	if fee := writeCache.MetaFee(3, path, META_LENGTH); fee != 2100 {
+		t.Error("Error: Wrong cold meta fee", fee)
+	}
+
+	writeCache.ReadWithFee(3, path, new(commutative.Path))
+	if fee := writeCache.MetaFee(3, path, META_ORDERED); fee != 100 {
+		t.Error("Error: Wrong warm meta fee", fee)
+	}
+
+	// Untracked, everything is cold.
+	writeCache.DisableAccessTracking()
+	if _, fee := writeCache.ReadWithFee(1, path+"a", new(noncommutative.Int64)); fee != 2100 {
+		t.Error("Error: Should be cold without the tracking", fee)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	common "github.com/arcology-network/common-lib/common"
+	slice "github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	univalue "github.com/arcology-network/storage-committer/type/univalue"
+)
+
+const ITERATOR_BATCH_SIZE = 256 // The number of the elements loaded from the backend at once.
+
+// PathIterator walks the elements of a container in the order of their keys in the container, either forward
+// or backward. The values are loaded in batches, the ones not in the cache are read from the backend together.
+// No access is recorded for the elements, the whole range is covered by a single range read, see RangeRead().
+type PathIterator struct {
+	cache *WriteCache
+	path  string
+	T     any
+
+	keys   []string // The sub keys to visit, in the visiting order.
+	values []any    // The values of the current batch.
+	offset int      // The position of the current batch in the keys.
+	pos    int      // The position in the keys, -1 before the first call to Next().
+
+	readSize uint64
+}
+
+// Iterate creates an iterator over the elements of a container, starting from the start key, or the first
+// element in the direction if it is empty. The limit is the maximum number of the elements to visit, 0 for all.
+// A range read on the container is recorded for the transaction, so it conflicts with any changes to the container
+// or the elements made by the other transactions.
+func (this *WriteCache) Iterate(tx uint64, path string, startKey string, limit int, reverse bool, T any) (*PathIterator, error) {
+	if !common.IsPath(path) {
+		return nil, errors.New("Error: Not a path!!!")
+	}
+
+	meta, _, _ := this.FindForRead(tx, path, new(commutative.Path), nil)
+	if meta == nil {
+		return nil, errors.New("Error: The path doesn't exist")
+	}
+	this.RangeRead(tx, path)
+
+	keys := slice.Clone(meta.(*commutative.Path).View().Elements())
+	if reverse {
+		slices.Reverse(keys)
+	}
+
+	if len(startKey) > 0 {
+		idx := slices.Index(keys, startKey)
+		if idx < 0 {
+			return nil, errors.New("Error: The start key doesn't exist in the path")
+		}
+		keys = keys[idx:]
+	}
+
+	if limit > 0 && limit < len(keys) {
+		keys = keys[:limit]
+	}
+
+	return &PathIterator{
+		cache:    this,
+		path:     path,
+		T:        T,
+		keys:     keys,
+		pos:      -1,
+		readSize: meta.(stgcommon.Type).MemSize(),
+	}, nil
+}
+
+// Next moves to the next element, it returns false when there are no more elements.
+func (this *PathIterator) Next() bool {
+	if this.pos+1 >= len(this.keys) {
+		this.pos = len(this.keys)
+		return false
+	}
+	this.pos++
+
+	if this.pos >= this.offset+len(this.values) {
+		this.offset = this.pos
+		this.load(this.keys[this.pos:min(this.pos+ITERATOR_BATCH_SIZE, len(this.keys))])
+	}
+	return true
+}
+
+func (this *PathIterator) Key() string  { return this.keys[this.pos] }             // The sub key of the current element.
+func (this *PathIterator) Path() string { return this.path + this.keys[this.pos] } // The full path of the current element.
+func (this *PathIterator) Value() any   { return this.values[this.pos-this.offset] }
+
+// ReadSize returns the size of the container meta and all the values loaded so far, for the fee calculation.
+func (this *PathIterator) ReadSize() uint64 { return this.readSize }
+
+// Load the values of a batch. The ones in the cache are read from the cache, the rest are read from the backend at once.
+func (this *PathIterator) load(subKeys []string) {
+	this.values = make([]any, len(subKeys))
+	missing, idxes := []string{}, []int{}
+	for i, subKey := range subKeys {
+		path := this.path + subKey
+		if univ, ok := this.cache.cached(path); ok { // Through the shard of the path and the spilled entries.
+			this.values[i] = univ.Value()
+			continue
+		}
+
+		if this.cache.RemovedWithAncestor(path) || this.cache.matchWildcard(path) {
+			continue // Deleted
+		}
+		missing, idxes = append(missing, path), append(idxes, i)
+	}
+
+	for i, v := range this.cache.batchRetrive(missing, this.T) {
+		this.values[idxes[i]] = v
+	}
+
+	for i, v := range this.values {
+		if v == nil {
+			continue
+		}
+		this.readSize += v.(stgcommon.Type).MemSize()
+		this.values[i], _, _ = v.(stgcommon.Type).Get()
+	}
+}
+
+// RangeRead records a read over all the elements of the container for the transaction. It is a read only entry
+// with a wildcard suffix, which is never exported as a transition. It conflicts with the writes to the container
+// or anything under it by the earlier transactions.
+func (this *WriteCache) RangeRead(tx uint64, path string) {
+	key := path + "*"
+	this.record(key)
+	if univ, ok := this.cached(key); ok && univ.IsReadOnly() {
+		univ.IncrementReads(1)
+		return
+	}
+	this.AddToDict(this.NewUnivalue().Init(tx, key, 1, 0, 0, nil, false))
+}
+
+// IsRangeRead checks if the access is a range read recorded by RangeRead().
+func IsRangeRead(v *univalue.Univalue) bool {
+	return v.GetPath() != nil && v.IsReadOnly() && v.Reads() > 0 && strings.HasSuffix(*v.GetPath(), "*")
+}
+
+// Check if the path has been deleted by any of the wildcards without loading it.
+func (this *WriteCache) matchWildcard(path string) bool {
+	for _, wildcard := range this.removals().committedDel {
+		if wildcard.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the values from the backend in one batch if it is supported, otherwise one by one.
+func (this *WriteCache) batchRetrive(keys []string, T any) []any {
+	if len(keys) == 0 || this.backend == nil {
+		return make([]any, len(keys))
+	}
+
+	if backend, ok := this.backend.(interface{ BatchRetrive([]string, []any) []any }); ok {
+		return backend.BatchRetrive(keys, slice.New[any](len(keys), T))
+	}
+
+	return slice.Transform(keys, func(_ int, k string) any {
+		v, _ := this.backend.Retrive(k, T)
+		return v
+	})
+}
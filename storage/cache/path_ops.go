@@ -24,8 +24,12 @@ package cache
 import (
 	"errors"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
 
 	common "github.com/arcology-network/common-lib/common"
+	slice "github.com/arcology-network/common-lib/exp/slice"
 	softdeltaset "github.com/arcology-network/common-lib/exp/softdeltaset"
 	stgcommon "github.com/arcology-network/storage-committer/common"
 	"github.com/arcology-network/storage-committer/type/commutative"
@@ -96,6 +100,8 @@ func (this *WriteCache) PeekCommitted(path string, T any) (any, uint64) {
 
 // This function looks up the value and carries out the operation on the value directly.
 func (this *WriteCache) DoReadOnly(tx uint64, path string, doer any, T any) (any, error) {
+	this.touch(tx, path)
+	this.record(path)
 	_, univalue, _ := this.FindForRead(tx, path, T, this.AddToDict) // Only if the doer is an read only operation, the value will be added to the cache.
 	return univalue.Do(tx, path, doer), nil
 }
@@ -128,34 +134,70 @@ func (this *WriteCache) getKeyByIdx(tx uint64, path string, idx uint64) (any, ui
 	), dataSize, nil
 }
 
-// get the key of the Nth element under a path
-func (this *WriteCache) Min(tx uint64, path string, idx uint64) (any, uint64, error) {
+// Read the container meta for the ordered operations. The whole container is read, so any insertion or
+// deletion by other transactions will conflict with it.
+func (this *WriteCache) orderedMeta(tx uint64, path string) (*commutative.Path, uint64, error) {
 	if !common.IsPath(path) {
 		return nil, stgcommon.MIN_READ_SIZE, errors.New("Error: Not a path!!!")
 	}
 
-	meta, _, dataSize := this.Read(tx, path, new(commutative.Path)) // read the container meta
-	if meta != nil {
-		if subKey, ok := meta.(*softdeltaset.DeltaSet[string]).KeyAt(idx); ok {
-			return path + *subKey, dataSize, nil
-		}
+	_, univ, dataSize := this.Read(tx, path, new(commutative.Path)) // read the container meta
+	if meta, ok := univ.(*univalue.Univalue).Value().(*commutative.Path); ok && meta != nil {
+		return meta, dataSize, nil
 	}
-	return "", dataSize, errors.New("Error: Key not found in the path!!!")
+	return nil, dataSize, errors.New("Error: The path doesn't exist!!!")
 }
 
-// get the key of the Nth element under a path
+// Get the full path of the Nth smallest key under a path, by the ordering of the container. The smallest one is at 0.
+func (this *WriteCache) Min(tx uint64, path string, idx uint64) (any, uint64, error) {
+	return this.findOrdered(tx, path, func(meta *commutative.Path) (string, bool) { return meta.Nth(idx, false) })
+}
+
+// Get the full path of the Nth largest key under a path, by the ordering of the container. The largest one is at 0.
 func (this *WriteCache) Max(tx uint64, path string, idx uint64) (any, uint64, error) {
-	if !common.IsPath(path) {
-		return nil, stgcommon.MIN_READ_SIZE, errors.New("Error: Not a path!!!")
+	return this.findOrdered(tx, path, func(meta *commutative.Path) (string, bool) { return meta.Nth(idx, true) })
+}
+
+// Get the full path of the first key not less than the given key.
+func (this *WriteCache) LowerBound(tx uint64, path string, key string) (any, uint64, error) {
+	return this.findOrdered(tx, path, func(meta *commutative.Path) (string, bool) { return meta.LowerBound(key) })
+}
+
+// Get the full path of the first key greater than the given key.
+func (this *WriteCache) UpperBound(tx uint64, path string, key string) (any, uint64, error) {
+	return this.findOrdered(tx, path, func(meta *commutative.Path) (string, bool) { return meta.UpperBound(key) })
+}
+
+func (this *WriteCache) findOrdered(tx uint64, path string, find func(*commutative.Path) (string, bool)) (any, uint64, error) {
+	meta, dataSize, err := this.orderedMeta(tx, path)
+	if err != nil {
+		return nil, dataSize, err
 	}
 
-	meta, _, dataSize := this.Read(tx, path, new(commutative.Path)) // read the container meta
-	if meta != nil {
-		if subkey, ok := meta.(*softdeltaset.DeltaSet[string]).KeyAt(idx); ok {
-			return path + *subkey, dataSize, nil
+	if subKey, ok := find(meta); ok {
+		return path + subKey, dataSize, nil
+	}
+	return nil, dataSize, errors.New("Error: Key not found in the path!!!")
+}
+
+// Remove the entries with the keys in [from, to) under a path. An empty upper bound means no upper bound.
+// It returns the number of entries removed and the accumulated data size.
+func (this *WriteCache) EraseRange(tx uint64, path string, from, to string) (int, int64, error) {
+	meta, readDataSize, err := this.orderedMeta(tx, path)
+	if err != nil {
+		return 0, int64(readDataSize), err
+	}
+
+	keys := meta.Range(from, to) // Collect the keys first, the writes below will change the container.
+	accumDataSize := int64(readDataSize)
+	for i, subKey := range keys {
+		writeDataSize, err := this.Write(tx, path+subKey, nil)
+		accumDataSize += writeDataSize
+		if err != nil {
+			return i, accumDataSize, err
 		}
 	}
-	return "", dataSize, errors.New("Error: Key not found in the path!!!")
+	return len(keys), accumDataSize, nil
 }
 
 // Read th Nth element under a path
@@ -190,29 +232,199 @@ func (this *WriteCache) PopBack(tx uint64, path string, T any) (any, int64, erro
 	return value, int64(_1stReadSize+_2ndReadSize) + writeDataSize, err
 }
 
-// Remove all the enties in a path, without a single read operation.
-// The length will stay the same, but the container will be empty. This is useful for avoiding meta level
-// conflicts when the container is appended.
-// func (this *WriteCache) EraseAll(tx uint64, path string, T any) (any, int64, error) {
-// 	if !common.IsPath(path) {
-// 		return nil, int64(stgcommon.MIN_READ_SIZE), errors.New("Error: Not a path!!!")
-// 	}
-// 	writeDataSize, err := this.Write(tx, path+"*", nil) // Remove the path from the cache, so that it will not be read again.
-
-// 	// meta, _, readDataSize := this.Peek(path, T) // read the container meta
-// 	// var accumReadGas uint64
-// 	// var accumWriteDataSize int64
-// 	// for _, subkey := range meta.(*softdeltaset.DeltaSet[string]).Elements() {
-// 	// 	key := path + subkey // Concatenate the path and the subkey
-// 	// 	writeData, err := this.Write(tx, key, nil)
-// 	// 	if err != nil {
-// 	// 		fmt.Printf("----------storage-committer/storage/cache/write_cache_reader.go----EraseAll for--key:%v--err:%v \n", key, err)
-// 	// 		// panic(err)
-// 	// 	}
-// 	// 	accumWriteDataSize += writeData
-// 	// }
-// 	return nil, writeDataSize, err
-// }
+// Remove all the enties in a path, without a single read operation. The container stays but it will be empty.
+// The elements already in the cache, either added by the transaction or loaded from the backend, are deleted
+// one by one, the rest are removed with a wildcard delete. They are expanded lazily by the readers through
+// MatchWildcard and by the committer at the commit time. Clearing the committed elements is a delta write to
+// the container meta, so it doesn't conflict with the concurrent appends to the same container.
+func (this *WriteCache) EraseAll(tx uint64, path string) (int64, error) {
+	if !common.IsPath(path) {
+		return int64(stgcommon.MIN_WRITE_SIZE), errors.New("Error: Not a path!!!")
+	}
+
+	if !this.IfExists(path) {
+		return int64(stgcommon.MIN_WRITE_SIZE), errors.New("Error: The path doesn't exist!!!")
+	}
+
+	// The cached ones would be found before the wildcard, so they need to be deleted directly.
+	loaded := []string{}
+	if _, meta, _ := this.FindForWrite(tx, path, new(commutative.Path), nil); meta.Value() != nil {
+		for _, key := range meta.Value().(*commutative.Path).View().Elements() {
+			if univ, ok := this.cached(path + key); ok && univ.Value() != nil {
+				loaded = append(loaded, path+key)
+			}
+		}
+	}
+
+	var accumWriteDataSize int64
+	for _, key := range loaded {
+		writeDataSize, err := this.Write(tx, key, nil)
+		accumWriteDataSize += writeDataSize
+		if err != nil {
+			return accumWriteDataSize, err
+		}
+	}
+
+	writeDataSize, err := this.Write(tx, path+"[:]", nil) // Clear the committed elements in the container meta.
+	if err == nil {
+		removals := this.removals()
+		removals.committedDel = append(removals.committedDel, &wildcardDelete{tx: tx, prefix: path})
+	}
+	return accumWriteDataSize + writeDataSize, err
+}
+
+// EraseKeys removes the listed keys under a path without reading the elements, the ones not in the container are
+// ignored. The elements in the cache are deleted directly, the committed ones are deleted with a wildcard matching
+// only these keys, so they are materialized lazily in the same way as the ones cleared by EraseAll.
+// Every key removed is a delta write to the container meta. It returns the number of the keys removed.
+func (this *WriteCache) EraseKeys(tx uint64, path string, keys []string) (int, int64, error) {
+	if !common.IsPath(path) {
+		return 0, int64(stgcommon.MIN_WRITE_SIZE), errors.New("Error: Not a path!!!")
+	}
+
+	if !this.IfExists(path) {
+		return 0, int64(stgcommon.MIN_WRITE_SIZE), errors.New("Error: The path doesn't exist!!!")
+	}
+
+	this.record(path)
+	_, meta, inCache := this.FindForWrite(tx, path, new(commutative.Path), this.AddToDict)
+
+	removed, lazy := 0, []string{}
+	var accumWriteDataSize int64
+	for _, key := range keys {
+		if ok, _ := meta.Value().(*commutative.Path).Exists(key); !ok {
+			continue
+		}
+
+		fullPath := path + key
+		if univ, ok := this.cached(fullPath); ok && univ.Value() != nil { // Loaded already, delete it directly.
+			writeDataSize, err := this.Write(tx, fullPath, nil)
+			accumWriteDataSize += writeDataSize
+			if err != nil {
+				return removed, accumWriteDataSize, err
+			}
+			removed++
+			continue
+		}
+
+		this.record(fullPath)
+		if err := meta.Set(tx, fullPath, nil, inCache, this); err != nil {
+			return removed, accumWriteDataSize, err
+		}
+		this.updateTombstones(fullPath, nil) // For the descendants of a sub path.
+
+		accumWriteDataSize += int64(stgcommon.MIN_WRITE_SIZE)
+		lazy = append(lazy, key)
+		removed++
+	}
+
+	if len(lazy) > 0 {
+		removals := this.removals()
+		removals.committedDel = append(removals.committedDel, newWildcardDelete(tx, path, lazy))
+	}
+	return removed, accumWriteDataSize, nil
+}
+
+// EraseIndexRange removes the elements at the indices in [from, to) under a path, an index range expression
+// of "path[from:to]". The indices are the positions of the keys in the container, the same as KeyAt().
+// The container meta is read to resolve the indices, so it conflicts with the concurrent insertions and deletions.
+func (this *WriteCache) EraseIndexRange(tx uint64, path string, from, to uint64) (int, int64, error) {
+	meta, readDataSize, err := this.orderedMeta(tx, path)
+	if err != nil {
+		return 0, int64(readDataSize), err
+	}
+
+	elems := meta.View().Elements()
+	to = min(to, uint64(len(elems)))
+	if from >= to {
+		return 0, int64(readDataSize), nil
+	}
+
+	removed, writeDataSize, err := this.EraseKeys(tx, path, slices.Clone(elems[from:to]))
+	return removed, int64(readDataSize) + writeDataSize, err
+}
+
+// EraseByType removes all the elements of the given type under a path, the sub paths are of commutative.PATH.
+// The values not in the cache are looked up in the backend in one batch, without being added to the cache.
+func (this *WriteCache) EraseByType(tx uint64, path string, typeID uint8) (int, int64, error) {
+	meta, readDataSize, err := this.orderedMeta(tx, path)
+	if err != nil {
+		return 0, int64(readDataSize), err
+	}
+
+	elems := slices.Clone(meta.View().Elements())
+	if meta.ElemType != 0 { // All the elements are of the same type.
+		removed, writeDataSize, err := this.EraseKeys(tx, path, common.IfThen(meta.ElemType == typeID, elems, nil))
+		return removed, int64(readDataSize) + writeDataSize, err
+	}
+
+	matched, uncached := []string{}, []string{}
+	for _, key := range elems {
+		if common.IsPath(key) {
+			if typeID == commutative.PATH {
+				matched = append(matched, key)
+			}
+			continue
+		}
+
+		if univ, ok := this.cached(path + key); ok {
+			if univ.Value() != nil && univ.Value().(stgcommon.Type).TypeID() == typeID {
+				matched = append(matched, key)
+			}
+			continue
+		}
+		uncached = append(uncached, key)
+	}
+
+	values := this.batchRetrive(slice.Transform(uncached, func(_ int, k string) string { return path + k }), nil)
+	for i, v := range values {
+		if v != nil && v.(stgcommon.Type).TypeID() == typeID {
+			matched = append(matched, uncached[i])
+		}
+	}
+
+	removed, writeDataSize, err := this.EraseKeys(tx, path, matched)
+	return removed, int64(readDataSize) + writeDataSize, err
+}
+
+// ErasePattern removes the elements under a path by an expression. Besides the "*" and "[:]" suffixes handled by
+// Write() and EraseAll(), an index range is supported as "path[from:to]", with either of the bounds optional.
+func (this *WriteCache) ErasePattern(tx uint64, expr string) (int, int64, error) {
+	path, from, to, err := ParseIndexRange(expr)
+	if err != nil {
+		return 0, int64(stgcommon.MIN_WRITE_SIZE), err
+	}
+	return this.EraseIndexRange(tx, path, from, to)
+}
+
+// ParseIndexRange splits an index range expression "path[from:to]" into the path and the bounds.
+// A missing lower bound is 0 and a missing upper bound is math.MaxUint64.
+func ParseIndexRange(expr string) (string, uint64, uint64, error) {
+	start := strings.LastIndex(expr, "[")
+	if start < 0 || !strings.HasSuffix(expr, "]") || !common.IsPath(expr[:start]) {
+		return "", 0, 0, errors.New("Error: Invalid index range expression!!!")
+	}
+
+	bounds := strings.Split(expr[start+1:len(expr)-1], ":")
+	if len(bounds) != 2 {
+		return "", 0, 0, errors.New("Error: Invalid index range expression!!!")
+	}
+
+	from, to := uint64(0), uint64(math.MaxUint64)
+	var err error
+	if len(bounds[0]) > 0 {
+		if from, err = strconv.ParseUint(bounds[0], 10, 64); err != nil {
+			return "", 0, 0, errors.New("Error: Invalid lower bound!!!")
+		}
+	}
+
+	if len(bounds[1]) > 0 {
+		if to, err = strconv.ParseUint(bounds[1], 10, 64); err != nil {
+			return "", 0, 0, errors.New("Error: Invalid upper bound!!!")
+		}
+	}
+	return expr[:start], from, to, nil
+}
 
 // Read th Nth element under a path
 // The way to do this is to use the keys in in the path first and then use the index to get the key.
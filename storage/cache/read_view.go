@@ -0,0 +1,148 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// ReadView is an immutable view of the execution cache, for the readers like the RPC handlers that need to read
+// it while a generation is being committed into it. The views are published RCU-style by the cache writers,
+// one after each generation. A reader loads the latest one and keeps using it, it is never changed afterwards.
+// The entries not in the view are read from the backend. The values are shared with the cache, they must not
+// be modified by the readers.
+//
+// Only the layers are pinned, the backend isn't. The layers are dropped once the block is committed, the entries
+// are read from the backend from then on. With the pipelined commits, the live storage serves the blocks still being
+// written from the staged batches, so the reads are never older than the last committed block. But a view held
+// across a block commit may see the values of the later blocks for the entries not in its layers, the readers
+// needing a consistent snapshot of a block should load a new view and read from it within the block.
+type ReadView struct {
+	epoch   uint64
+	layers  []map[string]*univalue.Univalue // The transitions of each generation, the latest last.
+	backend stgcommon.ReadOnlyStore
+}
+
+func (this *ReadView) Epoch() uint64 { return this.epoch } // Increases with every view published.
+
+// Get the entry in the view, the latest generation first.
+func (this *ReadView) Get(path string) (*univalue.Univalue, bool) {
+	for i := len(this.layers) - 1; i >= 0; i-- {
+		if univ, ok := this.layers[i][path]; ok {
+			return univ, true
+		}
+	}
+	return nil, false
+}
+
+func (this *ReadView) Retrive(path string, T any) (any, error) {
+	if univ, ok := this.Get(path); ok {
+		return univ.Value(), nil // Nil if deleted.
+	}
+
+	if this.backend == nil {
+		return nil, nil
+	}
+	return this.backend.Retrive(path, T)
+}
+
+func (this *ReadView) IfExists(path string) bool {
+	if univ, ok := this.Get(path); ok {
+		return univ.Value() != nil
+	}
+	return this.backend != nil && this.backend.IfExists(path)
+}
+
+func (this *ReadView) ReadStorage(path string, T any) (any, error) {
+	if this.backend == nil {
+		return nil, errors.New("Error: The backend is nil")
+	}
+	return this.backend.ReadStorage(path, T)
+}
+
+func (this *ReadView) Preload([]byte) any { return nil }
+
+// readViews keeps the layers of the generations applied in the current block and publishes the views. Only
+// the cache writer touches the layers, the readers only load the current view.
+type readViews struct {
+	layers  []map[string]*univalue.Univalue
+	epoch   uint64
+	current atomic.Pointer[ReadView]
+}
+
+// EnableReadViews turns on the concurrent reads through the views. Nothing changes for the cache itself, the
+// writers only need to publish a new view after applying each generation.
+func (this *WriteCache) EnableReadViews() *WriteCache {
+	this.views = &readViews{}
+	this.publishView()
+	return this
+}
+
+// ReadView returns the latest view, nil if the views aren't enabled. It is safe to call from any goroutine.
+func (this *WriteCache) ReadView() *ReadView {
+	if this.views == nil {
+		return nil
+	}
+	return this.views.current.Load()
+}
+
+// Publish the transitions of a generation just applied to the cache.
+func (this *WriteCache) publishGeneration(transitions []*univalue.Univalue) {
+	if this.views == nil {
+		return
+	}
+
+	layer := make(map[string]*univalue.Univalue, len(transitions))
+	for _, v := range transitions {
+		layer[*v.GetPath()] = v
+	}
+	this.views.layers = append(this.views.layers, layer)
+	this.publishView()
+}
+
+// Drop the layers of the generation and all the ones after it.
+func (this *WriteCache) revertViews(gen uint64) {
+	if this.views == nil || uint64(len(this.views.layers)) <= gen {
+		return
+	}
+	this.views.layers = this.views.layers[:gen]
+	this.publishView()
+}
+
+// The block is committed, everything is in the backend now.
+func (this *WriteCache) resetViews() {
+	if this.views == nil {
+		return
+	}
+	this.views.layers = this.views.layers[:0]
+	this.publishView()
+}
+
+func (this *WriteCache) publishView() {
+	this.views.epoch++
+	this.views.current.Store(&ReadView{
+		epoch:   this.views.epoch,
+		layers:  slices.Clone(this.views.layers), // The published views never share the slice with the later ones.
+		backend: this.backend,
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestReadView(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1).EnableReadViews()
+	writer := NewExecutionCacheWriter(writeCache, -1)
+
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001"
+	path := alice + "/storage/native/0"
+	before := writeCache.ReadView()
+
+	// The readers keep reading while the generations are being applied.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				writeCache.ReadView().Retrive(path, nil)
+			}
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		writer.Import([]*univalue.Univalue{univalue.NewUnivalue(1, path, 0, 1, 0, noncommutative.NewInt64(int64(i)), nil)})
+		writer.Precommit(true)
+	}
+	wg.Wait()
+
+	if v, _ := before.Retrive(path, nil); v != nil {
+		t.Error("Error: The published view should never change", v)
+	}
+
+	if v, _ := writeCache.ReadView().Retrive(path, nil); v == nil || *v.(*noncommutative.Int64) != 2 {
+		t.Error("Error: Should see the latest generation", v)
+	}
+
+	writer.RevertGeneration(1)
+	if v, _ := writeCache.ReadView().Retrive(path, nil); v == nil || *v.(*noncommutative.Int64) != 0 {
+		t.Error("Error: Should see the first generation only", v)
+	}
+
+	writer.Commit(0)
+	if _, ok := writeCache.ReadView().Get(path); ok || writeCache.ReadView().Epoch() <= before.Epoch() {
+		t.Error("Error: The view should be empty after the commit")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"runtime"
+
+	"github.com/arcology-network/common-lib/exp/associative"
+	slice "github.com/arcology-network/common-lib/exp/slice"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// ShardedCacheWriter is the ExecutionCacheWriter for the ShardedWriteCache. The transitions of a generation
+// are written to the shards in parallel.
+type ShardedCacheWriter struct {
+	*ExecutionCacheIndexer
+	*ShardedWriteCache
+	journal [][]*associative.Pair[string, *univalue.Univalue] // The entries overwritten by each generation, nil if there was none.
+	written uint64                                            // The number of transitions written in the last block.
+}
+
+func NewShardedCacheWriter(writeCache *ShardedWriteCache, version int64) *ShardedCacheWriter {
+	return &ShardedCacheWriter{
+		ExecutionCacheIndexer: NewExecutionCacheIndexer(nil, int64(version), nil),
+		ShardedWriteCache:     writeCache,
+		journal:               [][]*associative.Pair[string, *univalue.Univalue]{},
+	}
+}
+
+// Both the indexer and the cache have an Import, the writer imports into the indexer.
+func (this *ShardedCacheWriter) Import(transitions []*univalue.Univalue) {
+	this.ExecutionCacheIndexer.Import(transitions)
+}
+
+// Precommit writes the generation to the shards. The cache is updated in the synchronous phase only, a second
+// call in the asynchronous phase would journal and publish an empty generation.
+func (this *ShardedCacheWriter) Precommit(isSync bool) error {
+	if !isSync {
+		return nil
+	}
+	this.ExecutionCacheIndexer.Finalize() // Remove the nil transitions
+
+	buffer := this.ExecutionCacheIndexer.buffer
+	shards := slice.ParallelTransform(buffer, runtime.NumCPU(), func(_ int, v *univalue.Univalue) uint64 {
+		return this.shardID(*v.GetPath())
+	})
+
+	// Each shard only touches its own entries and the slots of the overwritten entries for them.
+	overwritten := make([]*associative.Pair[string, *univalue.Univalue], len(buffer))
+	slice.ParallelForeach(this.caches[:], runtime.NumCPU(), func(num int, shard **WriteCache) {
+		for i := range buffer {
+			if shards[i] == uint64(num) {
+				path := *buffer[i].GetPath()
+				overwritten[i] = &associative.Pair[string, *univalue.Univalue]{First: path, Second: (*shard).swap(path, buffer[i])}
+			}
+		}
+	})
+	this.journal = append(this.journal, overwritten)
+	this.Root().publishGeneration(buffer)
+	this.ExecutionCacheIndexer = NewExecutionCacheIndexer(nil, -1, nil)
+	return nil
+}
+
+func (this *ShardedCacheWriter) Commit(_ uint64) error {
+	this.written = 0
+	for _, overwritten := range this.journal {
+		this.written += uint64(len(overwritten))
+	}
+
+	this.ShardedWriteCache.Clear()
+	this.Root().resetViews()
+	this.ExecutionCacheIndexer.buffer = this.ExecutionCacheIndexer.buffer[:0]
+	this.journal = this.journal[:0]
+	return nil
+}
+
+// RevertGeneration restores the entries overwritten by the generation and all the generations after it.
+func (this *ShardedCacheWriter) RevertGeneration(gen uint64) {
+	for len(this.journal) > int(gen) {
+		overwritten := this.journal[len(this.journal)-1]
+		for i := len(overwritten) - 1; i >= 0; i-- { // In the reverse order, in case a path was written more than once.
+			this.Root().swap(overwritten[i].First, overwritten[i].Second)
+		}
+		this.journal = this.journal[:len(this.journal)-1]
+	}
+	this.Root().revertViews(gen)
+	this.ExecutionCacheIndexer = NewExecutionCacheIndexer(nil, -1, nil)
+}
+
+func (this *ShardedCacheWriter) Written() (uint64, uint64) { return this.written, 0 } // Nothing goes to the db.
+func (this *ShardedCacheWriter) IsSync() bool              { return true }
+func (this *ShardedCacheWriter) Name() string              { return "Sharded Execution Cache Writer" }
@@ -15,13 +15,16 @@
  *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
  */
 
-// WriteCache is a read-only data store used for caching.
+// ShardedWriteCache splits the execution cache into shards by the hashes of the paths.
 
 package cache
 
 import (
+	"fmt"
 	"runtime"
+	"sort"
 
+	common "github.com/arcology-network/common-lib/common"
 	slice "github.com/arcology-network/common-lib/exp/slice"
 	intf "github.com/arcology-network/storage-committer/common"
 	stgcommon "github.com/arcology-network/storage-committer/common"
@@ -35,11 +38,15 @@ const (
 // ShardedWriteCache is a lockless data strucuture that wraps multiple WriteCache instances together, each of
 // which is responsible for a subset of the data. It can be updated in parallel when a transaction generation
 // is completed. But it isn't thread-safe.
+//
+// The shards route the paths held by the other shards, the parent paths in particular, to them. So a child path
+// updates its parent path meta even if they are in different shards, and any of the shards works as a view of
+// the whole cache for the operations on individual paths. The removals, the tombstones and the wildcard deletes,
+// are kept by the first shard for all the shards.
 type ShardedWriteCache struct {
 	backend intf.ReadOnlyStore
 	caches  [NUM_SHARDS]*WriteCache
 	hasher  func(string) uint64
-	queue   chan *[]*univalue.Univalue
 }
 
 func NewShardedWriteCache(backend intf.ReadOnlyStore, perPage int, numPages int, hasher func(string) uint64, args ...interface{}) *ShardedWriteCache {
@@ -50,16 +57,45 @@ func NewShardedWriteCache(backend intf.ReadOnlyStore, perPage int, numPages int,
 
 	for i := 0; i < len(writeCache.caches); i++ {
 		writeCache.caches[i] = NewWriteCache(backend, perPage, numPages, args...)
+		writeCache.caches[i].shards = writeCache
 	}
-	writeCache.queue = make(chan *[]*univalue.Univalue, 64)
 	return writeCache
 }
 
 func (this *ShardedWriteCache) ReadOnlyStore() intf.ReadOnlyStore { return this.backend }
 func (this *ShardedWriteCache) Cache() [NUM_SHARDS]*WriteCache    { return this.caches }
+func (this *ShardedWriteCache) Root() *WriteCache                 { return this.caches[0] } // Keeps the removals.
+func (this *ShardedWriteCache) Preload([]byte) any                { return nil }
 
+func (this *ShardedWriteCache) shardID(path string) uint64 { return this.hasher(path) % NUM_SHARDS }
+func (this *ShardedWriteCache) shardOf(path string) *WriteCache {
+	return this.caches[this.shardID(path)]
+}
 func (this *ShardedWriteCache) NewUnivalue(k string) *univalue.Univalue {
-	return this.caches[this.hasher(k)].NewUnivalue()
+	return this.shardOf(k).NewUnivalue()
+}
+
+// The shard holding the path, the cache itself if it isn't sharded.
+func (this *WriteCache) shardOf(path string) *WriteCache {
+	if this.shards == nil {
+		return this
+	}
+	return this.shards.shardOf(path)
+}
+
+// The shard keeping the tombstones and the wildcard deletes for all the shards.
+func (this *WriteCache) removals() *WriteCache {
+	if this.shards == nil {
+		return this
+	}
+	return this.shards.Root()
+}
+
+func (this *WriteCache) allShards() []*WriteCache {
+	if this.shards == nil {
+		return []*WriteCache{this}
+	}
+	return this.shards.caches[:]
 }
 
 // ONLY THE TX WRITECACHE HAS THE NEED TO SUPPORT GET OR NOW
@@ -68,33 +104,75 @@ func (this *ShardedWriteCache) NewUnivalue(k string) *univalue.Univalue {
 // }
 
 func (this *ShardedWriteCache) Read(tx uint64, path string, T any) (interface{}, interface{}, uint64) {
-	return this.caches[this.hasher(path)%NUM_SHARDS].Read(tx, path, T)
+	return this.shardOf(path).Read(tx, path, T)
 }
 
-func (this *ShardedWriteCache) Write(tx uint64, path string, value interface{}) (int64, error) {
-	return this.caches[this.hasher(path)%NUM_SHARDS].Write(tx, path, value)
+func (this *ShardedWriteCache) Write(tx uint64, path string, value interface{}, args ...any) (int64, error) {
+	return this.shardOf(path).Write(tx, path, value, args...)
 }
 
-// func (this *ShardedWriteCache) GetIfCached(path string) (interface{}, bool) {
-// 	return this.caches[this.hasher(path)%NUM_SHARDS].GetIfCached(path)
-// }
+func (this *ShardedWriteCache) FindForRead(tx uint64, path string, T any, do func(*univalue.Univalue)) (any, *univalue.Univalue, bool) {
+	return this.shardOf(path).FindForRead(tx, path, T, do)
+}
+
+func (this *ShardedWriteCache) GetIfCached(path string) (interface{}, bool) {
+	return this.shardOf(path).GetIfCached(path)
+}
 
 func (this *ShardedWriteCache) Retrive(path string, T any) (interface{}, error) {
-	return this.caches[this.hasher(path)%NUM_SHARDS].Retrive(path, T)
+	return this.shardOf(path).Retrive(path, T)
+}
+
+func (this *ShardedWriteCache) ReadStorage(path string, T any) (interface{}, error) {
+	return this.shardOf(path).ReadStorage(path, T)
 }
 
 func (this *ShardedWriteCache) IfExists(path string) bool {
-	return this.caches[this.hasher(path)%NUM_SHARDS].IfExists(path)
+	return this.shardOf(path).IfExists(path)
 }
 
+// The read views are kept by the first shard, see WriteCache.EnableReadViews.
+func (this *ShardedWriteCache) EnableReadViews() *ShardedWriteCache {
+	this.Root().EnableReadViews()
+	return this
+}
+
+func (this *ShardedWriteCache) ReadView() *ReadView { return this.Root().ReadView() }
+
+func (this *ShardedWriteCache) EraseAll(tx uint64, path string) (int64, error) {
+	return this.shardOf(path).EraseAll(tx, path)
+}
+
+// The snapshot journal is kept by the first shard, see WriteCache.Snapshot.
+func (this *ShardedWriteCache) Snapshot() int { return this.Root().Snapshot() }
+func (this *ShardedWriteCache) RevertToSnapshot(id int) error {
+	return this.Root().RevertToSnapshot(id)
+}
+
+// Insert adds the transitions from the child writecaches, the same as WriteCache.Insert.
+func (this *ShardedWriteCache) Insert(transitions []*univalue.Univalue) *ShardedWriteCache {
+	this.Root().Insert(transitions) // The writes are routed to the shards.
+	return this
+}
+
+// Import sets the transitions in parallel by shard, if none of them would touch another shard. That is when
+// they are all updates whose parent paths are in the same shards and there is no removal to track. Otherwise,
+// they are set one by one, the parent paths before their children.
 func (this *ShardedWriteCache) Import(transitions []*univalue.Univalue) *ShardedWriteCache {
 	univalue.Univalues(transitions).SortByDepth() // To ensure that the parent  is inserted before the child
 
 	// Precalculate the shard ID of each transition
 	shards := slice.ParallelTransform(transitions, runtime.NumCPU(), func(i int, v *univalue.Univalue) uint64 {
-		return this.hasher(*(v).GetPath())
+		return this.shardID(*(v).GetPath())
 	})
 
+	if !this.isLocal(transitions, shards) {
+		for i := range transitions {
+			this.caches[shards[i]].set(transitions[i])
+		}
+		return this
+	}
+
 	// Insert each transition into the appropriate cache
 	slice.ParallelForeach(this.caches[:], runtime.NumCPU(), func(num int, shard **WriteCache) {
 		for i := 0; i < len(transitions); i++ {
@@ -106,6 +184,29 @@ func (this *ShardedWriteCache) Import(transitions []*univalue.Univalue) *Sharded
 	return this
 }
 
+// Check if the transitions can be set by their own shards without touching the others.
+func (this *ShardedWriteCache) isLocal(transitions []*univalue.Univalue, shards []uint64) bool {
+	if len(this.Root().tombstones) > 0 {
+		return false
+	}
+
+	for i, v := range transitions {
+		if v == nil || v.Value() == nil {
+			return false
+		}
+
+		path := *v.GetPath()
+		if clearPath, _ := common.TrimWildcardSuffix(path); clearPath != path {
+			return false
+		}
+
+		if parentPath, _ := common.GetParentPath(path); this.shardID(parentPath) != shards[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Reset the writecache to the initial state for the next round of processing.
 // func (this *ShardedWriteCache) Precommit([]uint32) [32]byte { return [32]byte{} }
 
@@ -125,18 +226,53 @@ func (this *ShardedWriteCache) Equal(other *ShardedWriteCache) bool {
 	return true
 }
 
-func (this *ShardedWriteCache) KVs() ([][]string, [][]stgcommon.Type) {
-	keySet, valueSet := make([][]string, len(this.caches)), make([][]stgcommon.Type, len(this.caches))
-	for i := 0; i < len(this.caches); i++ {
-		keySet[i], valueSet[i] = this.caches[i].KVs()
-	}
-	return keySet, valueSet
+// All the entries in all the shards, sorted by path.
+func (this *ShardedWriteCache) values() []*univalue.Univalue {
+	valueSet := make([][]*univalue.Univalue, len(this.caches))
+	slice.ParallelForeach(this.caches[:], runtime.NumCPU(), func(i int, wcache **WriteCache) {
+		valueSet[i] = (*wcache).entries()
+	})
+
+	values := slice.Flatten(valueSet)
+	sort.SliceStable(values, func(i, j int) bool {
+		return *values[i].GetPath() < *values[j].GetPath()
+	})
+	return values
 }
 
+// Export the content of all the shards, the same as WriteCache.Export.
 func (this *ShardedWriteCache) Export(preprocs ...func([]*univalue.Univalue) []*univalue.Univalue) []*univalue.Univalue {
-	valueSet := make([][]*univalue.Univalue, len(this.caches))
-	for i := 0; i < len(this.caches); i++ {
-		valueSet[i] = this.caches[i].Export()
+	buffer := this.values()
+	for _, proc := range preprocs {
+		buffer = common.IfThenDo1st(proc != nil, func() []*univalue.Univalue {
+			return proc(buffer)
+		}, buffer)
+	}
+	slice.RemoveIf(&buffer, func(_ int, v *univalue.Univalue) bool {
+		return v.PathLookupOnly() // Remove peeks and local values
+	})
+	return append(buffer, this.Root().WildcardsToUnivalue()...)
+}
+
+func (this *ShardedWriteCache) KVs() ([]string, []stgcommon.Type) {
+	transitions := univalue.Univalues(slice.Clone(this.Export(univalue.Sorter))).To(univalue.ITTransition{})
+
+	values := make([]stgcommon.Type, len(transitions))
+	keys := slice.ParallelTransform(transitions, 4, func(i int, v *univalue.Univalue) string {
+		values[i] = v.Value().(stgcommon.Type)
+		return *v.GetPath()
+	})
+	return keys, values
+}
+
+// Calculate the checksum of all the shards. It is the same as the one of a WriteCache with the same entries.
+func (this *ShardedWriteCache) Checksum() [32]byte {
+	return univalue.Univalues(this.values()).Checksum()
+}
+
+func (this *ShardedWriteCache) Print() {
+	for i, elem := range this.values() {
+		fmt.Println("Level : ", i)
+		elem.Print()
 	}
-	return slice.Flatten(valueSet)
 }
@@ -0,0 +1,133 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestShardedCacheWriter(t *testing.T) {
+	sharded := NewShardedWriteCache(nil, 16, 1, xxhash.Sum64String)
+	writer := NewShardedCacheWriter(sharded, -1)
+
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001"
+	paths := []string{alice + "/storage/native/0", alice + "/storage/native/1", alice + "/storage/native/2"}
+	for i, path := range paths {
+		writer.Import([]*univalue.Univalue{univalue.NewUnivalue(1, path, 0, 1, 0, noncommutative.NewInt64(int64(i)), nil)})
+	}
+	writer.Precommit(true)
+
+	for _, path := range paths {
+		if _, ok := sharded.GetIfCached(path); !ok {
+			t.Error("Error: Should be in the cache", path)
+		}
+
+		// Any shard works as a view of the whole cache.
+		if _, ok := sharded.Root().GetIfCached(path); !ok {
+			t.Error("Error: Should be found through the root shard", path)
+		}
+	}
+
+	if len(sharded.Export()) != len(paths) {
+		t.Error("Error: Wrong number of entries", len(sharded.Export()))
+	}
+
+	writer.RevertGeneration(0)
+	if len(sharded.Export()) != 0 {
+		t.Error("Error: The generation should have been reverted", len(sharded.Export()))
+	}
+}
+
+func TestShardedEraseAll(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	sharded := NewShardedWriteCache(newCommittedContainer(path), 16, 1, xxhash.Sum64String)
+
+	// The elements and the container are likely in different shards.
+	if _, err := sharded.Write(1, path+"c", noncommutative.NewInt64(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sharded.EraseAll(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sharded.IfExists(path) {
+		t.Error("Error: The container should stay")
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if sharded.IfExists(path + key) {
+			t.Error("Error: Should have been erased", key)
+		}
+	}
+
+	// The wildcard is kept by the root shard, so it is visible through every shard.
+	for _, key := range []string{"a", "b"} {
+		if matched, _ := sharded.shardOf(path+key).MatchWildcard(path+key, new(noncommutative.Int64)); !matched {
+			t.Error("Error: Should be deleted by the wildcard", key)
+		}
+	}
+
+	if exported := sharded.Root().WildcardsToUnivalue(); len(exported) != 1 || *exported[0].GetPath() != path+"*" {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+}
+
+func TestShardedSnapshot(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	sharded := NewShardedWriteCache(newCommittedContainer(path), 16, 1, xxhash.Sum64String)
+	sharded.Read(1, path+"a", new(noncommutative.Int64))
+
+	id := sharded.Snapshot()
+	sharded.Write(1, path+"a", noncommutative.NewInt64(5))
+	sharded.Write(1, path+"c", noncommutative.NewInt64(3))
+	if _, err := sharded.EraseAll(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sharded.RevertToSnapshot(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Back in its own shard only.
+	for i, shard := range sharded.Cache() {
+		if _, ok := shard.kvDict[path+"a"]; ok != (shard == sharded.shardOf(path+"a")) {
+			t.Error("Error: The entry is restored to the wrong shard", i)
+		}
+	}
+
+	if v, _ := sharded.GetIfCached(path + "a"); *v.(*univalue.Univalue).Value().(*noncommutative.Int64) != 1 {
+		t.Error("Error: The value should have been restored", v)
+	}
+
+	if _, ok := sharded.GetIfCached(path + "c"); ok {
+		t.Error("Error: The entry written after the snapshot should have gone")
+	}
+
+	if !sharded.IfExists(path+"b") || len(sharded.Root().WildcardsToUnivalue()) != 0 {
+		t.Error("Error: The wildcard delete should have been reverted")
+	}
+
+	if len(sharded.Export()) != 1 { // Only the read before the snapshot.
+		t.Error("Error: Wrong entries after the revert", len(sharded.Export()))
+	}
+}
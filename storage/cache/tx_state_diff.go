@@ -0,0 +1,160 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// tx_state_diff.go pairs the values before and after each transaction in the format of
+// the diff mode of geth's prestateTracer. Only the changed fields are included.
+//
+
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/arcology-network/common-lib/common"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	platform "github.com/arcology-network/storage-committer/platform"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+	"github.com/holiman/uint256"
+)
+
+const nativeStoragePrefix = "/storage/native/"
+
+// AccountState is the state of an account in a prestate or poststate. The Arcology container entries,
+// including the container paths themselves, are keyed by their paths under the account.
+type AccountState struct {
+	Balance    *uint256.Int   `json:"balance,omitempty"`
+	Nonce      *uint64        `json:"nonce,omitempty"`
+	Code       []byte         `json:"code,omitempty"`
+	Storage    map[string]any `json:"storage,omitempty"`
+	Containers map[string]any `json:"containers,omitempty"`
+}
+
+// TxStateDiff contains the states before and after a transaction by account address. An account isn't in the
+// prestate if it was created by the transaction, and a field isn't in the poststate if it was deleted.
+type TxStateDiff struct {
+	Tx   uint64                   `json:"tx"`
+	Pre  map[string]*AccountState `json:"pre"`
+	Post map[string]*AccountState `json:"post"`
+}
+
+// TxStateDiffs groups the transitions by transaction and pairs them with the prestate values.
+// The prestate function returns the value of a path before the transaction. Only the writes under
+// the accounts are included and the results are sorted by tx.
+func TxStateDiffs(transitions []*univalue.Univalue, prestate func(uint64, string, any) any) []*TxStateDiff {
+	plat := platform.NewPlatform()
+	diffs := map[uint64]*TxStateDiff{}
+	for _, v := range transitions {
+		if v == nil || v.GetPath() == nil || v.IsReadOnly() || v.PathLookupOnly() {
+			continue
+		}
+
+		path := *v.GetPath()
+		if len(path) <= stgcommon.ETH10_ACCOUNT_FULL_LENGTH || (plat.IsSysPath(path) && common.IsPath(path)) {
+			continue // Not under an account or the builtin account structure.
+		}
+
+		diff, ok := diffs[v.GetTx()]
+		if !ok {
+			diff = &TxStateDiff{Tx: v.GetTx(), Pre: map[string]*AccountState{}, Post: map[string]*AccountState{}}
+			diffs[v.GetTx()] = diff
+		}
+
+		addr := platform.GetAccountAddr(path)
+		pre := prestate(v.GetTx(), path, v.Value())
+		setState(diff.Pre, addr, path, pre)
+		setState(diff.Post, addr, path, poststate(pre, v.Value()))
+	}
+
+	txDiffs := make([]*TxStateDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		txDiffs = append(txDiffs, diff)
+	}
+	sort.Slice(txDiffs, func(i, j int) bool { return txDiffs[i].Tx < txDiffs[j].Tx })
+	return txDiffs
+}
+
+// TxStateDiffs returns the per-transaction diffs of all the writes in the cache. The prestate values
+// are loaded from the committed state in the backend.
+func (this *WriteCache) TxStateDiffs() []*TxStateDiff {
+	return TxStateDiffs(this.Export(), func(tx uint64, path string, T any) any {
+		return this.LoadFromCommitted(tx, path, T).Value()
+	})
+}
+
+// The value after the transition. A commutative transition only carries its delta, which is applied to a
+// copy of the prestate. The container paths carry the committed elements already, so they are used as they are.
+func poststate(pre, post any) any {
+	typedv, ok := post.(stgcommon.Type)
+	if _, isPath := post.(*commutative.Path); !ok || isPath || pre == nil || !typedv.IsCommutative() || typedv.IsDeltaApplied() {
+		return post
+	}
+
+	applied, _, err := pre.(stgcommon.Type).Clone().(stgcommon.Type).ApplyDelta([]stgcommon.Type{typedv})
+	if err != nil {
+		return post
+	}
+	return applied
+}
+
+// Put the value in the right field of the account state. Nil values are left out.
+func setState(states map[string]*AccountState, addr, path string, typedv any) {
+	if typedv == nil {
+		return
+	}
+
+	state, ok := states[addr]
+	if !ok {
+		state = &AccountState{}
+		states[addr] = state
+	}
+
+	// The delta, if any, is applied to the value.
+	var raw any
+	if meta, ok := typedv.(*commutative.Path); ok {
+		raw = meta.View().Elements()
+	} else {
+		raw, _, _ = typedv.(stgcommon.Type).Get()
+	}
+
+	switch subPath := path[stgcommon.ETH10_ACCOUNT_FULL_LENGTH:]; {
+	case subPath == "/balance":
+		balance := raw.(uint256.Int)
+		state.Balance = &balance
+
+	case subPath == "/nonce":
+		nonce := raw.(uint64)
+		state.Nonce = &nonce
+
+	case subPath == "/code":
+		state.Code = raw.([]byte)
+
+	case strings.HasPrefix(subPath, nativeStoragePrefix):
+		if state.Storage == nil {
+			state.Storage = map[string]any{}
+		}
+		state.Storage[subPath[len(nativeStoragePrefix):]] = raw
+
+	default:
+		if state.Containers == nil {
+			state.Containers = map[string]any{}
+		}
+		state.Containers[subPath] = raw
+	}
+}
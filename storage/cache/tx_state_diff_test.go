@@ -0,0 +1,61 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestTxStateDiffs(t *testing.T) {
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001"
+	committed := map[string]any{
+		alice + "/balance":          commutative.NewU256DeltaFromU64(100, true),
+		alice + "/storage/native/0": noncommutative.NewInt64(1),
+	}
+
+	transitions := []*univalue.Univalue{
+		univalue.NewUnivalue(1, alice+"/balance", 0, 0, 1, commutative.NewU256DeltaFromU64(10, true), nil),
+		univalue.NewUnivalue(2, alice+"/storage/native/0", 0, 1, 0, noncommutative.NewInt64(2), nil),
+		univalue.NewUnivalue(2, alice+"/storage/native/1", 0, 1, 0, noncommutative.NewInt64(3), nil),
+		univalue.NewUnivalue(2, alice+"/storage/native/2", 1, 0, 0, noncommutative.NewInt64(4), nil), // Read only
+		univalue.NewUnivalue(2, alice+"/", 0, 1, 0, commutative.NewPath(), nil),                      // Builtin path
+	}
+
+	diffs := TxStateDiffs(transitions, func(_ uint64, path string, _ any) any { return committed[path] })
+	if len(diffs) != 2 || diffs[0].Tx != 1 || diffs[1].Tx != 2 {
+		t.Fatal("Error: Wrong number of tx diffs", len(diffs))
+	}
+
+	addr := "0x0000000000000000000000000000000000000001"
+	if pre, post := diffs[0].Pre[addr], diffs[0].Post[addr]; pre.Balance.Uint64() != 100 || post.Balance.Uint64() != 110 {
+		t.Error("Error: Wrong balance", pre.Balance, post.Balance)
+	}
+
+	if pre := diffs[1].Pre[addr]; !reflect.DeepEqual(pre.Storage, map[string]any{"0": int64(1)}) || pre.Balance != nil {
+		t.Error("Error: Wrong prestate", pre.Storage)
+	}
+
+	if post := diffs[1].Post[addr]; !reflect.DeepEqual(post.Storage, map[string]any{"0": int64(2), "1": int64(3)}) || post.Containers != nil {
+		t.Error("Error: Wrong poststate", post.Storage)
+	}
+}
@@ -34,8 +34,6 @@ import (
 	"strings"
 
 	common "github.com/arcology-network/common-lib/common"
-	"github.com/arcology-network/common-lib/exp/associative"
-	mapi "github.com/arcology-network/common-lib/exp/map"
 	mempool "github.com/arcology-network/common-lib/exp/mempool"
 	slice "github.com/arcology-network/common-lib/exp/slice"
 	stgcommon "github.com/arcology-network/storage-committer/common"
@@ -47,10 +45,23 @@ import (
 // WriteCache is a read-only data backend used for caching.
 type WriteCache struct {
 	backend      stgcommon.ReadOnlyStore
-	kvDict       map[string]*univalue.Univalue       // Local KV lookup
-	committedDel []*associative.Pair[uint64, string] // Paths delete by wildcard
+	kvDict       map[string]*univalue.Univalue // Local KV lookup
+	committedDel []*wildcardDelete             // Paths delete by wildcard
 	platform     stgeth.Platform
 	pool         *mempool.Mempool[*univalue.Univalue]
+	journal      snapshotJournal    // To revert to the snapshots.
+	shards       *ShardedWriteCache // The sharded cache it is a part of, nil if it is standalone.
+	views        *readViews         // For the concurrent readers, nil if not enabled.
+	fees         FeeSchedule        // To charge the state accesses.
+	spill        *spillStore        // The cold entries moved to the disk, nil if there is no memory budget.
+	poolStats    PoolStats
+	warm         map[uint64]*warmSet // The EIP-2929 warm sets by tx, nil if the accesses aren't tracked.
+
+	// The paths whose descendants have been removed, either deleted along with the paths or cleared by wildcards,
+	// and the paths written since, by sequence numbers. A descendant written before its ancestor was removed is gone.
+	tombstones map[string]uint64
+	writeSeqs  map[string]uint64
+	seq        uint64
 }
 
 // NewWriteCache creates a new instance of WriteCache; the backend can be another instance of WriteCache,
@@ -59,8 +70,12 @@ func NewWriteCache(backend stgcommon.ReadOnlyStore, perPage int, numPages int, a
 	return &WriteCache{
 		backend:      backend,
 		kvDict:       make(map[string]*univalue.Univalue),
-		committedDel: make([]*associative.Pair[uint64, string], 0),
+		committedDel: make([]*wildcardDelete, 0),
 		platform:     *stgeth.NewPlatform(),
+		tombstones:   map[string]uint64{},
+		writeSeqs:    map[string]uint64{},
+		fees:         NewEthFeeSchedule(),
+		poolStats:    PoolStats{PerPage: perPage, NumPages: numPages},
 		pool: mempool.NewMempool(perPage, numPages, func() *univalue.Univalue {
 			return new(univalue.Univalue)
 		}, (&univalue.Univalue{}).Reset),
@@ -72,30 +87,44 @@ func (this *WriteCache) SetReadOnlyBackend(backend stgcommon.ReadOnlyStore) *Wri
 	return this
 }
 
-func (this *WriteCache) AddToDict(v *univalue.Univalue)         { this.kvDict[*v.GetPath()] = v }
+func (this *WriteCache) AddToDict(v *univalue.Univalue) {
+	shard := this.shardOf(*v.GetPath())
+	shard.kvDict[*v.GetPath()] = v
+	if shard.spill != nil {
+		shard.spill.stats.Used += entrySize(v)
+	}
+}
 func (this *WriteCache) ReadOnlyStore() stgcommon.ReadOnlyStore { return this.backend }
-func (this *WriteCache) Cache() *map[string]*univalue.Univalue  { return &this.kvDict }
-func (this *WriteCache) Preload([]byte) any                     { return nil } //.
+func (this *WriteCache) Cache() *map[string]*univalue.Univalue {
+	this.unspillAll()
+	return &this.kvDict
+}
+func (this *WriteCache) Preload([]byte) any { return nil } //.
 // Placeholder
-func (this *WriteCache) NewUnivalue() *univalue.Univalue { return this.pool.New() }
+func (this *WriteCache) NewUnivalue() *univalue.Univalue {
+	this.poolStats.InUse++
+	this.poolStats.Peak = max(this.poolStats.Peak, this.poolStats.InUse)
+	return this.pool.New()
+}
 
 // Check if the current entry is in its parents' records. This is used when
 // the entry is deleted through a wildcard deletion, in this case, if the
 // entry is not in the write cache,
 // it won't be touched, but it is not in the parent records to mark it as deleted.
 
-// Recursively check IS NOT supported yet. It is not fully implemented for multi-level containers.
-// But the single level is fine to use.
-
 // Imagine a path like /a/b/c/d. We delete all the sub paths of /a/*
 // and because c and d are not in the write cache, they are not touched, only marked
 // as deleted in the parent path which is a's child list. But they may still be in the storage.
 // So when we check if they still exist and if we only query by their paths directly we can
 // still find them and their immediate parent path also exists, although their grandparent path
-// are gone. Unless we recursively check the parent paths, we can't tell if they are truly gone.
-// This requires a lot of queries and decoding.
+// are gone. Instead of decoding the parent paths level by level, the removed ancestors are
+// looked up in the tombstones, which is only a map lookup per level.
 
 func (this *WriteCache) ExistsInParent(path string) bool {
+	if this.RemovedWithAncestor(path) {
+		return false
+	}
+
 	// No metadata for immediate children of system paths.
 	if this.platform.IsImmediateChildOfSysPath(path) {
 		return true
@@ -111,6 +140,29 @@ func (this *WriteCache) ExistsInParent(path string) bool {
 	return false
 }
 
+// RemovedWithAncestor checks if any of the ancestors of the path, up to MAX_DEPTH levels, has been removed
+// after the path was last written in the cache.
+func (this *WriteCache) RemovedWithAncestor(path string) bool {
+	removals := this.removals()
+	if len(removals.tombstones) == 0 {
+		return false
+	}
+
+	written := removals.writeSeqs[path]
+	for i := uint8(0); i < stgcommon.MAX_DEPTH; i++ {
+		parentPath, _ := common.GetParentPath(path)
+		if len(parentPath) <= stgcommon.ETH10_ACCOUNT_FULL_LENGTH || len(parentPath) >= len(path) {
+			break // No containers above the account level.
+		}
+
+		if seq, ok := removals.tombstones[parentPath]; ok && seq > written {
+			return true
+		}
+		path = parentPath
+	}
+	return false
+}
+
 // Get the raw value directly, put it in an empty univalue without recording
 // the access at the univalue level. Won't update the kvDict.
 func (this *WriteCache) FindForRead(tx uint64, path string, T any, do func(*univalue.Univalue)) (any, *univalue.Univalue, bool) {
@@ -121,13 +173,18 @@ func (this *WriteCache) FindForRead(tx uint64, path string, T any, do func(*univ
 }
 
 func (this *WriteCache) FindForWrite(tx uint64, path string, T any, do func(*univalue.Univalue)) (any, *univalue.Univalue, bool) {
-	if univ, ok := this.kvDict[path]; ok {
+	if shard := this.shardOf(path); shard != this {
+		return shard.FindForWrite(tx, path, T, do) // Held by another shard, the parent paths mostly.
+	}
+
+	if univ, ok := this.cached(path); ok {
 		return univ.Value(), univ, true // From cache
 	}
 
 	// If the path is a covered by a wildcard.
 	if matched, univ := this.MatchWildcard(path, T); matched {
-		this.kvDict[path] = univ // Add to the cache
+		this.record(path)
+		this.swap(path, univ) // Add to the cache
 		return univ.Value(), univ, false
 	}
 
@@ -139,6 +196,9 @@ func (this *WriteCache) FindForWrite(tx uint64, path string, T any, do func(*uni
 }
 
 func (this *WriteCache) Write(tx uint64, path string, newVal any, args ...any) (int64, error) {
+	this.maybeSpill() // Before the write, so the entries in use are still in memory.
+	this.touch(tx, path)
+
 	if newVal != nil && newVal.(stgcommon.Type).TypeID() == uint8(reflect.Invalid) { // Neither a valid replacement nor a delete operation.
 		return 0, errors.New("Error: Unknown data type !")
 	}
@@ -153,6 +213,9 @@ func (this *WriteCache) Write(tx uint64, path string, newVal any, args ...any) (
 
 func (this *WriteCache) write(tx uint64, path string, value any) (*univalue.Univalue, error) {
 	parentPath, _ := common.GetParentPath(path)
+	this.record(path)
+	this.record(parentPath)
+
 	univ := univalue.NewUnivalue(tx, path, 0, 1, 0, value, nil) // Default univalue wrapper
 	if this.IfExists(parentPath) || tx == stgcommon.SYSTEM {    // The parent path exists or to inject the path directly
 		var err error
@@ -166,6 +229,8 @@ func (this *WriteCache) write(tx uint64, path string, value any) (*univalue.Univ
 
 		// Update the parent path meta
 		if err == nil {
+			this.updateTombstones(path, value)
+
 			// Only track of the children of concurrent paths.
 			if strings.HasSuffix(parentPath, "/container/") || !this.platform.IsSysPath(parentPath) && tx != stgcommon.SYSTEM {
 				_, parentMeta, inCache := this.FindForWrite(tx, parentPath, new(commutative.Path), this.AddToDict)
@@ -182,6 +247,29 @@ func (this *WriteCache) write(tx uint64, path string, value any) (*univalue.Univ
 	return univ, errors.New("Error: The parent path " + parentPath + " doesn't exist for " + path)
 }
 
+// A deleted path or a path cleared by a wildcard removes all its descendants. A write after that brings the path back.
+func (this *WriteCache) updateTombstones(path string, value any) {
+	removals := this.removals()
+	if value == nil {
+		if clearPath, subPath := common.TrimWildcardSuffix(path); clearPath != path {
+			if subPath == "*" && common.IsPath(clearPath) { // Cleared with a wildcard, the path itself stays.
+				this.record(clearPath)
+				removals.seq++
+				removals.tombstones[clearPath] = removals.seq
+			} // Only the committed elements are cleared by "[:]", they are gone from the container meta already.
+		} else if common.IsPath(path) {
+			removals.seq++
+			removals.tombstones[path] = removals.seq
+		}
+		return
+	}
+
+	if len(removals.tombstones) > 0 { // Written before any removal is the same as never written.
+		removals.seq++
+		removals.writeSeqs[path] = removals.seq
+	}
+}
+
 // Get the raw value directly WITHOUT tracking the accessing record.
 // Users need to count access themselves.
 func (this *WriteCache) Retrive(path string, T any) (any, error) {
@@ -223,6 +311,9 @@ func (this *WriteCache) ReadStorage(key string, T any) (any, error) {
 }
 
 func (this *WriteCache) Read(tx uint64, path string, T any) (any, any, uint64) {
+	this.maybeSpill()
+	this.touch(tx, path)
+	this.record(path)                                               // The access counters will change.
 	_, univalue, _ := this.FindForRead(tx, path, T, this.AddToDict) // Get the univalue wrapper
 
 	// need to check if it is in the memory. If so gas price should be 3 instead.
@@ -250,7 +341,7 @@ func (this *WriteCache) DiffSize(tx uint64, path string, newVal any) int64 {
 
 // Get the raw value directly, skip the access counting at the univalue level
 func (this *WriteCache) GetIfCached(path string) (any, bool) {
-	univ, ok := this.kvDict[path]
+	univ, ok := this.cached(path)
 	return univ, ok
 }
 
@@ -262,11 +353,11 @@ func (this *WriteCache) IfExists(path string) bool {
 		return true
 	}
 
-	if v := this.kvDict[path]; v != nil {
+	if v, _ := this.cached(path); v != nil {
 		return v.Value() != nil // If value == nil means either it's been deleted or never existed.
 	}
 
-	if this.backend == nil {
+	if this.backend == nil || this.RemovedWithAncestor(path) || this.matchWildcard(path) {
 		return false
 	}
 
@@ -296,6 +387,11 @@ func (this *WriteCache) Insert(transitions []*univalue.Univalue) *WriteCache {
 		return this
 	}
 
+	// The range reads have no values to copy, they are recorded for the same transactions directly.
+	for _, v := range slice.MoveIf(&transitions, func(_ int, v *univalue.Univalue) bool { return IsRangeRead(v) }) {
+		this.RangeRead(v.GetTx(), strings.TrimSuffix(*v.GetPath(), "*"))
+	}
+
 	// Filter out the path creations transitions as they will be treated differently.
 	newPathCreations := slice.MoveIf(&transitions, func(_ int, v *univalue.Univalue) bool {
 		return common.IsPath(*v.GetPath()) && !v.IsCommitted()
@@ -325,17 +421,25 @@ func (this *WriteCache) Insert(transitions []*univalue.Univalue) *WriteCache {
 // Reset the writecache to the initial state for the next round of processing.
 func (this *WriteCache) Clear() *WriteCache {
 	this.pool.Reset()
+	this.poolStats.InUse = 0
+	this.poolStats.Resets++
+	this.resetSpill()
 	clear(this.kvDict)
+	this.committedDel = this.committedDel[:0]
+	clear(this.tombstones)
+	clear(this.writeSeqs)
+	clear(this.warm)
+	this.journal = snapshotJournal{}
 	return this
 }
 
 func (this *WriteCache) Equal(other *WriteCache) bool {
-	thisBuffer := mapi.Values(this.kvDict)
+	thisBuffer := this.entries()
 	sort.SliceStable(thisBuffer, func(i, j int) bool {
 		return *thisBuffer[i].GetPath() < *thisBuffer[j].GetPath()
 	})
 
-	otherBuffer := mapi.Values(other.kvDict)
+	otherBuffer := other.entries()
 	sort.SliceStable(otherBuffer, func(i, j int) bool {
 		return *otherBuffer[i].GetPath() < *otherBuffer[j].GetPath()
 	})
@@ -346,8 +450,9 @@ func (this *WriteCache) Equal(other *WriteCache) bool {
 
 // Export the content of the writecache to two arrays of univalues.
 // One for the accesses and the other for the transitions.
+// The spilled entries are read from the disk, they stay there.
 func (this *WriteCache) Export(preprocs ...func([]*univalue.Univalue) []*univalue.Univalue) []*univalue.Univalue {
-	buffer := mapi.Values(this.kvDict)
+	buffer := this.entries()
 	for _, proc := range preprocs {
 		buffer = common.IfThenDo1st(proc != nil, func() []*univalue.Univalue {
 			return proc(buffer)
@@ -384,7 +489,7 @@ func (this *WriteCache) KVs() ([]string, []stgcommon.Type) {
 // This function is used to write the cache to the data source directly to bypass all the intermediate steps,
 // including the conflict detection.
 func (this *WriteCache) Print() {
-	values := mapi.Values(this.kvDict)
+	values := this.entries()
 	sort.SliceStable(values, func(i, j int) bool {
 		return *values[i].GetPath() < *values[j].GetPath()
 	})
@@ -397,7 +502,7 @@ func (this *WriteCache) Print() {
 
 // Calculate the checksum of the writecache for integrity check.
 func (this *WriteCache) Checksum() [32]byte {
-	values := mapi.Values(this.kvDict)
+	values := this.entries()
 	sort.SliceStable(values, func(i, j int) bool {
 		return *values[i].GetPath() < *values[j].GetPath()
 	})
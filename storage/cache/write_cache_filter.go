@@ -46,6 +46,7 @@ func (this *WriteCacheFilter) ToBuffer() []*univalue.Univalue {
 }
 
 func (this *WriteCacheFilter) RemoveByAddress(addr string) {
+	this.unspillAll()
 	commonlibcommon.MapRemoveIf(this.kvDict,
 		func(path string, _ *univalue.Univalue) bool {
 			return path[stgcommon.ETH10_ACCOUNT_PREFIX_LENGTH:stgcommon.ETH10_ACCOUNT_PREFIX_LENGTH+stgcommon.ETH10_ACCOUNT_LENGTH] == addr
@@ -0,0 +1,137 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"errors"
+
+	univalue "github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// snapshotJournal keeps what is needed to undo the changes to the write cache made after each of the snapshots.
+// Only the entries changed after a snapshot are recorded, on their first change, so a snapshot costs
+// nothing until the entries are actually touched.
+type snapshotJournal struct {
+	snapshots []writeCacheSnapshot
+	undoLog   []*undoEntry
+	recorded  map[string]bool // The paths recorded since the latest snapshot.
+	warmLog   []warmEntry     // The paths and the addresses that became warm since the first snapshot.
+}
+
+// The state of a path before its first change after a snapshot.
+type undoEntry struct {
+	path      string
+	univ      *univalue.Univalue // The copy of the entry, nil if it wasn't in the cache.
+	written   uint64             // The sequence number of the last write, see WriteCache.tombstones.
+	tombstone uint64
+}
+
+type writeCacheSnapshot struct {
+	undoLog      int // The length of the undo log when the snapshot was taken.
+	committedDel int // The number of the wildcard deletes when the snapshot was taken.
+	warmLog      int // The length of the warm log when the snapshot was taken.
+}
+
+// Snapshot marks the current state of the write cache, which can be restored with RevertToSnapshot later.
+// The snapshots can be nested, for example, one for each EVM call frame. In a sharded cache, the journal is
+// kept by the first shard along with the removals, so any of the shards can take and revert the snapshots.
+func (this *WriteCache) Snapshot() int {
+	removals := this.removals()
+	journal := &removals.journal
+	journal.snapshots = append(journal.snapshots, writeCacheSnapshot{
+		undoLog:      len(journal.undoLog),
+		committedDel: len(removals.committedDel),
+		warmLog:      len(journal.warmLog),
+	})
+	journal.recorded = map[string]bool{}
+	return len(journal.snapshots) - 1
+}
+
+// RevertToSnapshot undoes all the changes made after the snapshot, including the values, the access counters,
+// the changes to the parent paths and the wildcard deletes. The snapshot and all the ones taken after it are
+// no longer valid after that.
+func (this *WriteCache) RevertToSnapshot(id int) error {
+	removals := this.removals()
+	journal := &removals.journal
+	if id < 0 || id >= len(journal.snapshots) {
+		return errors.New("Error: Invalid snapshot id")
+	}
+	snapshot := journal.snapshots[id]
+
+	// In the reverse order, so an entry ends up in the state before its first change after the snapshot.
+	// The entries go back to their shards, replacing the spilled copies if there are any.
+	for i := len(journal.undoLog) - 1; i >= snapshot.undoLog; i-- {
+		entry := journal.undoLog[i]
+		this.swap(entry.path, entry.univ)
+		setOrDelete(removals.writeSeqs, entry.path, entry.written)
+		setOrDelete(removals.tombstones, entry.path, entry.tombstone)
+	}
+	journal.undoLog = journal.undoLog[:snapshot.undoLog]
+	removals.committedDel = removals.committedDel[:snapshot.committedDel]
+
+	// The accessed addresses and storage keys are reverted with the call frames too, see EIP-2929.
+	for _, entry := range journal.warmLog[snapshot.warmLog:] {
+		if set := removals.warm[entry.tx]; set == nil {
+			continue // The tracking has been turned off since.
+		} else if entry.isAddr {
+			delete(set.addrs, entry.key)
+		} else {
+			delete(set.paths, entry.key)
+		}
+	}
+	journal.warmLog = journal.warmLog[:snapshot.warmLog]
+	journal.snapshots = journal.snapshots[:id]
+
+	// The paths recorded since the previous snapshot, if there is one, are still in the undo log.
+	journal.recorded = map[string]bool{}
+	if id > 0 {
+		for _, entry := range journal.undoLog[journal.snapshots[id-1].undoLog:] {
+			journal.recorded[entry.path] = true
+		}
+	}
+	return nil
+}
+
+// Record the entry before its first change since the latest snapshot. Nothing is recorded without a snapshot.
+func (this *WriteCache) record(path string) {
+	if removals := this.removals(); len(removals.journal.snapshots) > 0 {
+		removals.recordEntry(path)
+	}
+}
+
+// Called on the shard keeping the journal.
+func (this *WriteCache) recordEntry(path string) {
+	if this.journal.recorded[path] {
+		return
+	}
+	this.journal.recorded[path] = true
+
+	entry := &undoEntry{path: path, written: this.writeSeqs[path], tombstone: this.tombstones[path]}
+	if univ, ok := this.cached(path); ok {
+		entry.univ = univ.Clone().(*univalue.Univalue) // Both the value and the access counters.
+	}
+	this.journal.undoLog = append(this.journal.undoLog, entry)
+}
+
+func setOrDelete(dict map[string]uint64, key string, v uint64) {
+	if v == 0 {
+		delete(dict, key)
+		return
+	}
+	dict[key] = v
+}
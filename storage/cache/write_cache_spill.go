@@ -0,0 +1,298 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"errors"
+	"os"
+
+	common "github.com/arcology-network/common-lib/common"
+	mapi "github.com/arcology-network/common-lib/exp/map"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// PoolStats is about the univalue pool of the write cache, for tuning the perPage and numPages of NewWriteCache.
+// If the peak often goes over the capacity, the pool needs more pages.
+type PoolStats struct {
+	PerPage  int
+	NumPages int
+	InUse    uint64 // The univalues taken from the pool since the last reset.
+	Peak     uint64 // The most univalues in use between two resets.
+	Resets   uint64
+}
+
+func (this PoolStats) Capacity() uint64 { return uint64(this.PerPage) * uint64(this.NumPages) }
+
+// SpillStats is about the entries spilled to the disk.
+type SpillStats struct {
+	Budget    uint64 // The memory budget in bytes.
+	Used      uint64 // The estimated memory used by the entries in memory.
+	Entries   int    // The entries on the disk now.
+	DiskBytes int64  // The size of the spill file.
+	Spilled   uint64 // The total number of entries spilled.
+	Reloaded  uint64 // The total number of entries reloaded.
+}
+
+// spillStore keeps the cold entries of the write cache in a temporary file. Only the index is in memory.
+// The file is append only, the space of the reloaded entries is reclaimed when the cache is cleared.
+type spillStore struct {
+	file   *os.File
+	offset int64
+	index  map[string][2]int64 // The offset and the length of each entry in the file.
+	stats  SpillStats
+}
+
+// SetMemoryBudget caps the estimated memory used by the entries in the cache. After the budget is exceeded,
+// the read-only entries are spilled to a temporary file under the directory until the usage drops to half
+// the budget. They are reloaded transparently when accessed again and read from the file directly by the
+// exports. The container metas, the written entries and the range reads always stay in memory. The codec
+// doesn't keep the deltas of the commutative values or the flags of the written entries, and the written
+// entries are exported as transitions at the end anyway, so only the reads are worth spilling.
+func (this *WriteCache) SetMemoryBudget(budget uint64, dir string) error {
+	if this.spill != nil {
+		this.spill.stats.Budget = budget
+		return nil
+	}
+
+	file, err := os.CreateTemp(dir, "writecache-spill-*")
+	if err != nil {
+		return err
+	}
+
+	this.spill = &spillStore{file: file, index: map[string][2]int64{}, stats: SpillStats{Budget: budget}}
+	for _, v := range this.kvDict {
+		this.spill.stats.Used += entrySize(v)
+	}
+	return nil
+}
+
+// DisableSpill moves all the spilled entries back into memory and removes the spill file.
+func (this *WriteCache) DisableSpill() error {
+	if this.spill == nil {
+		return nil
+	}
+
+	this.unspillAll()
+	name := this.spill.file.Name()
+	this.spill.file.Close()
+	this.spill = nil
+	return os.Remove(name)
+}
+
+func (this *WriteCache) PoolStats() PoolStats { return this.poolStats }
+
+func (this *WriteCache) SpillStats() SpillStats {
+	if this.spill == nil {
+		return SpillStats{}
+	}
+
+	stats := this.spill.stats
+	stats.Entries = len(this.spill.index)
+	stats.DiskBytes = this.spill.offset
+	return stats
+}
+
+// Look up the entry in the memory first and then in the spill file. A spilled entry is moved back into memory.
+func (this *WriteCache) cached(path string) (*univalue.Univalue, bool) {
+	shard := this.shardOf(path)
+	if univ, ok := shard.kvDict[path]; ok || shard.spill == nil {
+		return univ, ok
+	}
+
+	if univ := shard.unspill(path); univ != nil {
+		return univ, true
+	}
+	return nil, false
+}
+
+// The memory an entry takes roughly, the path, the univalue itself and the value.
+func entrySize(v *univalue.Univalue) uint64 {
+	size := uint64(len(*v.GetPath())) + 128
+	if v.Value() != nil {
+		size += v.Value().(interface{ MemSize() uint64 }).MemSize()
+	}
+	return size
+}
+
+// Only the entries that survive the codec as they are.
+func spillable(v *univalue.Univalue) bool {
+	return v.IsReadOnly() && !v.IsBlockBound() && !v.IsExpanded() && !IsRangeRead(v) &&
+		!common.IsType[*commutative.Path](v.Value())
+}
+
+// Spill the read-only entries when the memory budget is exceeded. Small enough to be inlined on the access paths.
+func (this *WriteCache) maybeSpill() {
+	if this.spill != nil && this.spill.stats.Used > this.spill.stats.Budget {
+		this.spillCold()
+	}
+}
+
+// Spill the read-only entries until the usage is down to half the budget.
+func (this *WriteCache) spillCold() {
+	for path, v := range this.kvDict {
+		if this.spill.stats.Used <= this.spill.stats.Budget/2 {
+			break
+		}
+
+		if !spillable(v) {
+			continue
+		}
+
+		if err := this.spill.put(path, v); err != nil {
+			return // Keep the rest in memory.
+		}
+		delete(this.kvDict, path)
+		this.spill.stats.Used -= min(entrySize(v), this.spill.stats.Used)
+	}
+}
+
+// Move a spilled entry back into memory. The spilled copy is stale if the path has been written since.
+func (this *WriteCache) unspill(path string) *univalue.Univalue {
+	if univ, ok := this.kvDict[path]; ok {
+		delete(this.spill.index, path)
+		return univ
+	}
+
+	univ, err := this.spill.get(path)
+	if univ == nil || err != nil {
+		return nil
+	}
+
+	this.kvDict[path] = univ
+	this.spill.stats.Used += entrySize(univ)
+	return univ
+}
+
+// Put the entry into the shard of the path, or remove it if v is nil, and return the one replaced, spilled or not.
+// The writers write to the cache through it, so the spilled copies don't shadow the new entries and the memory
+// usage is kept up to date.
+func (this *WriteCache) swap(path string, v *univalue.Univalue) *univalue.Univalue {
+	shard := this.shardOf(path)
+	old, ok := shard.kvDict[path]
+	if shard.spill != nil {
+		if ok {
+			shard.spill.stats.Used -= min(entrySize(old), shard.spill.stats.Used)
+		} else {
+			old, _ = shard.spill.get(path)
+			delete(shard.spill.index, path) // Superseded, even if it couldn't be read.
+		}
+
+		if v != nil {
+			shard.spill.stats.Used += entrySize(v)
+		}
+	}
+
+	if v == nil {
+		delete(shard.kvDict, path)
+	} else {
+		shard.kvDict[path] = v
+	}
+	return old
+}
+
+// The entries in memory and the spilled ones, which are read from the file without being moved back into memory.
+func (this *WriteCache) entries() []*univalue.Univalue {
+	values := mapi.Values(this.kvDict)
+	if this.spill == nil {
+		return values
+	}
+
+	for path := range this.spill.index {
+		if univ, err := this.spill.read(path); univ != nil && err == nil {
+			values = append(values, univ)
+		}
+	}
+	return values
+}
+
+// Move all the spilled entries back into memory, before the operations on the whole cache.
+func (this *WriteCache) unspillAll() {
+	for _, shard := range this.allShards() {
+		if shard.spill == nil {
+			continue
+		}
+
+		for path := range shard.spill.index {
+			shard.unspill(path)
+		}
+	}
+}
+
+func (this *WriteCache) resetSpill() {
+	if this.spill == nil {
+		return
+	}
+
+	clear(this.spill.index)
+	this.spill.offset = 0
+	this.spill.stats.Used = 0
+	this.spill.file.Truncate(0)
+}
+
+// The nil values aren't encoded, a flag byte goes before the encoded univalue.
+func (this *spillStore) put(path string, v *univalue.Univalue) error {
+	buffer := append([]byte{0}, v.Encode()...)
+	if v.Value() == nil {
+		buffer[0] = 1
+	}
+
+	if _, err := this.file.WriteAt(buffer, this.offset); err != nil {
+		return err
+	}
+
+	this.index[path] = [2]int64{this.offset, int64(len(buffer))}
+	this.offset += int64(len(buffer))
+	this.stats.Spilled++
+	return nil
+}
+
+// Read and remove the entry from the index.
+func (this *spillStore) get(path string) (*univalue.Univalue, error) {
+	univ, err := this.read(path)
+	if univ == nil || err != nil {
+		return nil, err
+	}
+
+	delete(this.index, path)
+	this.stats.Reloaded++
+	return univ, nil
+}
+
+// Read the entry, it stays on the disk.
+func (this *spillStore) read(path string) (*univalue.Univalue, error) {
+	loc, ok := this.index[path]
+	if !ok {
+		return nil, nil
+	}
+
+	buffer := make([]byte, loc[1])
+	if _, err := this.file.ReadAt(buffer, loc[0]); err != nil {
+		return nil, err
+	}
+
+	if len(buffer) == 0 {
+		return nil, errors.New("Error: Corrupted spill entry for " + path)
+	}
+
+	univ := (&univalue.Univalue{}).Decode(buffer[1:]).(*univalue.Univalue)
+	if buffer[0] == 1 {
+		univ.SetValue(nil)
+	}
+	return univ, nil
+}
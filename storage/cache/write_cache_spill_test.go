@@ -0,0 +1,120 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestWriteCacheSpill(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+	if err := writeCache.SetMemoryBudget(1024, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer writeCache.DisableSpill()
+
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+	for i := 0; i < 64; i++ {
+		writeCache.AddToDict(univalue.NewUnivalue(1, alice+strconv.Itoa(i), 1, 0, 0, noncommutative.NewInt64(int64(i)), nil))
+	}
+	writeCache.AddToDict(univalue.NewUnivalue(1, alice+"written", 0, 1, 0, noncommutative.NewInt64(-1), nil))
+
+	writeCache.maybeSpill()
+	stats := writeCache.SpillStats()
+	if stats.Entries == 0 || stats.Used > stats.Budget {
+		t.Fatal("Error: Should have spilled to the disk", stats)
+	}
+
+	if _, ok := writeCache.kvDict[alice+"written"]; !ok {
+		t.Error("Error: The written entries should stay in memory")
+	}
+
+	// Reloaded transparently.
+	for i := 0; i < 64; i++ {
+		v, ok := writeCache.GetIfCached(alice + strconv.Itoa(i))
+		if !ok || *v.(*univalue.Univalue).Value().(*noncommutative.Int64) != noncommutative.Int64(i) || v.(*univalue.Univalue).Reads() != 1 {
+			t.Fatal("Error: Wrong reloaded entry", i, v)
+		}
+	}
+
+	if stats := writeCache.SpillStats(); stats.Entries != 0 || stats.Reloaded != stats.Spilled {
+		t.Error("Error: Everything should have been reloaded", stats)
+	}
+}
+
+func TestWriteCachePoolStats(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 2)
+	for i := 0; i < 40; i++ {
+		writeCache.NewUnivalue()
+	}
+	writeCache.Clear()
+	writeCache.NewUnivalue()
+
+	if stats := writeCache.PoolStats(); stats.Capacity() != 32 || stats.Peak != 40 || stats.InUse != 1 || stats.Resets != 1 {
+		t.Error("Error: Wrong pool stats", stats)
+	}
+}
+
+func TestWriteCacheSpillPrecommit(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+	if err := writeCache.SetMemoryBudget(1024, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer writeCache.DisableSpill()
+
+	alice := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/native/"
+	for i := 0; i < 64; i++ {
+		writeCache.AddToDict(univalue.NewUnivalue(1, alice+strconv.Itoa(i), 1, 0, 0, noncommutative.NewInt64(int64(i)), nil))
+	}
+	writeCache.maybeSpill()
+
+	spilled := ""
+	for path := range writeCache.spill.index {
+		spilled = path
+		break
+	}
+
+	// The export reads the spilled entries from the disk, without going over the budget.
+	if exported := writeCache.Export(); len(exported) != 64 || writeCache.SpillStats().Entries != len(writeCache.spill.index) || writeCache.SpillStats().Used > 1024 {
+		t.Error("Error: The spilled entries should be exported from the disk", len(exported), writeCache.SpillStats())
+	}
+
+	// The precommitted value replaces the spilled copy.
+	writer := NewExecutionCacheWriter(writeCache, -1)
+	writer.Import([]*univalue.Univalue{univalue.NewUnivalue(2, spilled, 0, 1, 0, noncommutative.NewInt64(-1), nil)})
+	writer.Precommit(true)
+
+	if _, ok := writeCache.spill.index[spilled]; ok {
+		t.Fatal("Error: The spilled copy should have been dropped")
+	}
+
+	writeCache.unspillAll()
+	if v, _ := writeCache.GetIfCached(spilled); *v.(*univalue.Univalue).Value().(*noncommutative.Int64) != -1 {
+		t.Error("Error: The precommitted value should have been kept", v)
+	}
+
+	// The reverted generation brings the old value back.
+	writer.RevertGeneration(0)
+	if v, _ := writeCache.GetIfCached(spilled); *v.(*univalue.Univalue).Value().(*noncommutative.Int64) == -1 {
+		t.Error("Error: The old value should have been restored", v)
+	}
+}
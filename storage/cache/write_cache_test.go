@@ -17,7 +17,14 @@
 package cache
 
 import (
+	"math"
+	"reflect"
+	"strconv"
 	"testing"
+
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
 )
 
 func TestWriteCachePool(t *testing.T) {
@@ -29,3 +36,188 @@ func TestWriteCachePool(t *testing.T) {
 	// })
 
 }
+
+func TestWriteCacheSnapshot(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache.AddToDict(univalue.NewUnivalue(1, path, 1, 0, 0, commutative.NewPath(), nil))
+	if _, err := writeCache.Write(1, path+"a", noncommutative.NewInt64(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	univ, _ := writeCache.GetIfCached(path + "a")
+	reads, writes := univ.(*univalue.Univalue).Reads(), univ.(*univalue.Univalue).Writes()
+
+	id := writeCache.Snapshot()
+	writeCache.Write(1, path+"a", noncommutative.NewInt64(2))
+	writeCache.Write(1, path+"b", noncommutative.NewInt64(3))
+	writeCache.Read(1, path+"a", new(noncommutative.Int64))
+	if _, err := writeCache.EraseAll(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeCache.RevertToSnapshot(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// The value and the access counters.
+	univ, _ = writeCache.GetIfCached(path + "a")
+	if v := univ.(*univalue.Univalue); *v.Value().(*noncommutative.Int64) != 1 || v.Reads() != reads || v.Writes() != writes {
+		t.Error("Error: The entry should have been restored", v.Reads(), v.Writes())
+	}
+
+	if _, ok := writeCache.GetIfCached(path + "b"); ok {
+		t.Error("Error: The entry written after the snapshot should have gone")
+	}
+
+	// The parent path and the wildcard delete.
+	meta, _, _ := writeCache.FindForRead(1, path, new(commutative.Path), nil)
+	if keys := meta.(*commutative.Path).View().Elements(); len(keys) != 1 || keys[0] != "a" {
+		t.Error("Error: The container should have been restored", keys)
+	}
+
+	if writeCache.matchWildcard(path + "c") {
+		t.Error("Error: The wildcard delete should have been reverted")
+	}
+
+	if writeCache.RevertToSnapshot(id) == nil {
+		t.Error("Error: The snapshot is no longer valid")
+	}
+}
+
+func TestPathIterator(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+	writeCache.Write(1, path+"c", noncommutative.NewInt64(3)) // Pending
+	writeCache.Write(1, path+"d", noncommutative.NewInt64(4))
+	writeCache.Write(1, path+"b", nil) // Committed, then deleted.
+
+	collect := func(startKey string, limit int, reverse bool) ([]string, []int64) {
+		iter, err := writeCache.Iterate(1, path, startKey, limit, reverse, new(noncommutative.Int64))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys, values := []string{}, []int64{}
+		for iter.Next() {
+			keys, values = append(keys, iter.Key()), append(values, iter.Value().(int64))
+		}
+		return keys, values
+	}
+
+	// The committed elements first, then the pending ones.
+	if keys, values := collect("", 0, false); !reflect.DeepEqual(keys, []string{"a", "c", "d"}) || !reflect.DeepEqual(values, []int64{1, 3, 4}) {
+		t.Error("Error: Wrong elements", keys, values)
+	}
+
+	if keys, _ := collect("c", 2, true); !reflect.DeepEqual(keys, []string{"c", "a"}) {
+		t.Error("Error: Wrong elements in the reverse order", keys)
+	}
+
+	if _, err := writeCache.Iterate(1, path, "b", 0, false, new(noncommutative.Int64)); err == nil {
+		t.Error("Error: The deleted key can't be the start key")
+	}
+
+	// A single range read for all the iterations, the elements aren't loaded into the cache.
+	if univ, ok := writeCache.GetIfCached(path + "*"); !ok || !IsRangeRead(univ.(*univalue.Univalue)) || univ.(*univalue.Univalue).Reads() != 3 {
+		t.Error("Error: The range read should have been recorded", univ)
+	}
+
+	if _, ok := writeCache.GetIfCached(path + "a"); ok {
+		t.Error("Error: The committed element shouldn't be loaded")
+	}
+}
+
+func TestPathOrderedOps(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+	writeCache.Write(1, path+"c", noncommutative.NewInt64(3)) // Pending
+	writeCache.Write(1, path+"d", noncommutative.NewInt64(4))
+
+	// The committed and the pending keys are in the same order.
+	for _, expected := range []struct {
+		find func() (any, uint64, error)
+		key  string
+	}{
+		{func() (any, uint64, error) { return writeCache.Min(1, path, 0) }, "a"},
+		{func() (any, uint64, error) { return writeCache.Min(1, path, 2) }, "c"},
+		{func() (any, uint64, error) { return writeCache.Max(1, path, 0) }, "d"},
+		{func() (any, uint64, error) { return writeCache.Max(1, path, 3) }, "a"},
+		{func() (any, uint64, error) { return writeCache.LowerBound(1, path, "bb") }, "c"},
+		{func() (any, uint64, error) { return writeCache.LowerBound(1, path, "b") }, "b"},
+		{func() (any, uint64, error) { return writeCache.UpperBound(1, path, "b") }, "c"},
+	} {
+		if key, _, err := expected.find(); err != nil || key != path+expected.key {
+			t.Error("Error: Wrong key", key, expected.key, err)
+		}
+	}
+
+	if _, _, err := writeCache.Max(1, path, 4); err == nil {
+		t.Error("Error: Out of range")
+	}
+
+	if _, _, err := writeCache.UpperBound(1, path, "d"); err == nil {
+		t.Error("Error: Nothing greater than the last key")
+	}
+
+	// A committed key and a pending one in [b, d).
+	if removed, _, err := writeCache.EraseRange(1, path, "b", "d"); err != nil || removed != 2 {
+		t.Fatal("Error: Wrong number of keys removed", removed, err)
+	}
+
+	for key, exists := range map[string]bool{"a": true, "b": false, "c": false, "d": true} {
+		if writeCache.IfExists(path+key) != exists {
+			t.Error("Error: Wrong existence", key)
+		}
+	}
+
+	if key, _, _ := writeCache.Min(1, path, 1); key != path+"d" {
+		t.Error("Error: The erased keys should be skipped", key)
+	}
+
+	if removed, _, err := writeCache.EraseRange(1, path, "", ""); err != nil || removed != 2 || writeCache.IfExists(path+"a") {
+		t.Error("Error: Everything should have been removed", removed, err)
+	}
+}
+
+// The reads of the cached entries, with and without the access tracking, the snapshots and the spilling.
+func BenchmarkWriteCacheRead(b *testing.B) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	newCache := func() *WriteCache {
+		writeCache := NewWriteCache(nil, 1024, 4)
+		meta := commutative.NewPath().(*commutative.Path)
+		meta.SetSubPaths(keys)
+		writeCache.AddToDict(univalue.NewUnivalue(1, path, 1, 0, 0, meta, nil))
+		for i, key := range keys {
+			writeCache.AddToDict(univalue.NewUnivalue(1, path+key, 1, 0, 0, noncommutative.NewInt64(int64(i)), nil))
+		}
+		return writeCache
+	}
+
+	b.Run("untracked", func(b *testing.B) {
+		writeCache := newCache()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			writeCache.Read(1, path+keys[i%len(keys)], new(noncommutative.Int64))
+		}
+	})
+
+	b.Run("tracked", func(b *testing.B) {
+		writeCache := newCache().EnableAccessTracking()
+		writeCache.Snapshot()
+		if err := writeCache.SetMemoryBudget(math.MaxUint64, b.TempDir()); err != nil {
+			b.Fatal(err)
+		}
+		defer writeCache.DisableSpill()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			writeCache.Read(1, path+keys[i%len(keys)], new(noncommutative.Int64))
+		}
+	})
+}
@@ -18,20 +18,51 @@
 package cache
 
 import (
-	"bytes"
+	"strings"
 
 	"github.com/arcology-network/storage-committer/type/univalue"
 )
 
+// wildcardDelete is a bulk delete of the committed elements under a container, either all of them or only
+// the listed keys. The elements aren't loaded at the time of the delete, they are materialized on the first access.
+type wildcardDelete struct {
+	tx     uint64
+	prefix string
+	keys   []string // The keys under the prefix in the order of deletion, nil for all the elements.
+	lookup map[string]struct{}
+}
+
+func newWildcardDelete(tx uint64, prefix string, keys []string) *wildcardDelete {
+	lookup := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		lookup[key] = struct{}{}
+	}
+	return &wildcardDelete{tx: tx, prefix: prefix, keys: keys, lookup: lookup}
+}
+
+// Check if the path is under the container and is one of the keys deleted, or a descendant of one.
+func (this *wildcardDelete) match(path string) bool {
+	if len(path) <= len(this.prefix) || !strings.HasPrefix(path, this.prefix) { // The container itself isn't deleted.
+		return false
+	}
+
+	if this.keys == nil {
+		return true
+	}
+
+	subKey := path[len(this.prefix):]
+	if idx := strings.Index(subKey, "/"); idx >= 0 { // Under a deleted sub path.
+		subKey = subKey[:idx+1]
+	}
+	_, ok := this.lookup[subKey]
+	return ok
+}
+
 // PreloadMatched preloads the paths that match the wildcard delete path that are about to be deleted by the
 // the current write operation.
 func (this *WriteCache) MatchWildcard(path string, T any) (bool, *univalue.Univalue) {
-	for _, wildcardPath := range this.committedDel {
-		if len(path) < len(wildcardPath.Second) {
-			continue
-		}
-
-		if bytes.Equal([]byte(path[:len(wildcardPath.Second)]), []byte(wildcardPath.Second)) {
+	for _, wildcard := range this.removals().committedDel {
+		if wildcard.match(path) {
 			univ := this.LoadFromCommitted(0, path, T) // Preload the path from the backend
 			univ.SetValue(nil)                         // To indicate t the path has been deleted by the wildcard
 			univ.IncrementWrites(1)
@@ -41,13 +72,28 @@ func (this *WriteCache) MatchWildcard(path string, T any) (bool, *univalue.Univa
 	return false, nil
 }
 
-// WildcardsToUnivalue converts wildcard paths to Univalue for exporting.
+// WildcardsToUnivalue converts wildcard paths to Univalue for exporting. A wildcard for all the elements is
+// exported as a single path with the "*" suffix, which is expanded by the committer against the committed
+// store. The keys of a pattern-based delete are known already, so they are exported as the deletes of the keys.
 func (this *WriteCache) WildcardsToUnivalue() []*univalue.Univalue {
 	univs := make([]*univalue.Univalue, 0)
-	for _, wildcardPath := range this.committedDel {
-		newV := univalue.NewUnivalue(wildcardPath.First, wildcardPath.Second+"*", 0, 1, 0, nil, nil)
-		newV.SetPreexist(true) // Mark as pre-existing, so it pass through the filter.
-		univs = append(univs, newV)
+	for _, wildcard := range this.committedDel {
+		if wildcard.keys == nil {
+			newV := univalue.NewUnivalue(wildcard.tx, wildcard.prefix+"*", 0, 1, 0, nil, nil)
+			newV.SetPreexist(true) // Mark as pre-existing, so it pass through the filter.
+			univs = append(univs, newV)
+			continue
+		}
+
+		for _, key := range wildcard.keys {
+			if _, ok := this.shardOf(wildcard.prefix + key).kvDict[wildcard.prefix+key]; ok {
+				continue // Loaded after the delete, it is exported with the cache already.
+			}
+
+			newV := univalue.NewUnivalue(wildcard.tx, wildcard.prefix+key, 0, 1, 0, nil, nil)
+			newV.SetPreexist(true)
+			univs = append(univs, newV)
+		}
 	}
 	return univs
 }
@@ -0,0 +1,252 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"math"
+	"testing"
+
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// A container with the committed elements "a" and "b" in a backend cache.
+func newCommittedContainer(path string) *WriteCache {
+	committed := NewWriteCache(nil, 16, 1)
+	meta := commutative.NewPath().(*commutative.Path)
+	meta.SetSubPaths([]string{"a", "b"})
+	committed.AddToDict(univalue.NewUnivalue(0, path, 1, 0, 0, meta, nil))
+	committed.AddToDict(univalue.NewUnivalue(0, path+"a", 0, 1, 0, noncommutative.NewInt64(1), nil))
+	committed.AddToDict(univalue.NewUnivalue(0, path+"b", 0, 1, 0, noncommutative.NewInt64(2), nil))
+	return committed
+}
+
+func TestEraseAll(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+
+	if _, err := writeCache.Write(1, path+"c", noncommutative.NewInt64(3)); err != nil { // Added by the tx itself.
+		t.Fatal(err)
+	}
+
+	if v, _, _ := writeCache.Read(1, path+"a", new(noncommutative.Int64)); v == nil { // Loaded from the backend.
+		t.Fatal("Error: Should have been read")
+	}
+
+	if _, err := writeCache.EraseAll(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The container stays, but it is empty.
+	meta, _, _ := writeCache.FindForRead(1, path, new(commutative.Path), nil)
+	if !writeCache.IfExists(path) || meta == nil || len(meta.(*commutative.Path).View().Elements()) != 0 {
+		t.Error("Error: The container should be alive and empty")
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if writeCache.IfExists(path + key) {
+			t.Error("Error: Should have been erased", key)
+		}
+	}
+
+	// The one loaded before is deleted directly.
+	if univ, ok := writeCache.GetIfCached(path + "a"); !ok || univ.(*univalue.Univalue).Value() != nil {
+		t.Error("Error: Should have been deleted in the cache")
+	}
+
+	// The one never loaded is deleted on the first access.
+	if _, ok := writeCache.GetIfCached(path + "b"); ok {
+		t.Error("Error: Shouldn't have been loaded")
+	}
+
+	if matched, univ := writeCache.MatchWildcard(path+"b", new(noncommutative.Int64)); !matched || univ.Value() != nil || univ.Writes() != 1 {
+		t.Error("Error: Should be deleted by the wildcard")
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if v, _, _ := writeCache.Read(1, path+key, new(noncommutative.Int64)); v != nil {
+			t.Error("Error: Should read nothing", key, v)
+		}
+	}
+
+	// Exported as a single wildcard delete.
+	if exported := writeCache.WildcardsToUnivalue(); len(exported) != 1 || *exported[0].GetPath() != path+"*" || exported[0].Value() != nil {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+}
+
+func TestEraseKeys(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	meta := commutative.NewPath().(*commutative.Path)
+	meta.SetSubPaths([]string{"a", "b", "c", "d"})
+	writeCache.AddToDict(univalue.NewUnivalue(1, path, 1, 0, 0, meta, nil))
+
+	if removed, _, err := writeCache.EraseKeys(1, path, []string{"b", "d", "x"}); err != nil || removed != 2 {
+		t.Fatal("Error: Wrong number of keys removed", removed, err)
+	}
+
+	if !writeCache.matchWildcard(path+"b") || !writeCache.matchWildcard(path+"d") || writeCache.matchWildcard(path+"a") || writeCache.matchWildcard(path) {
+		t.Error("Error: Only the keys removed should match")
+	}
+
+	if keys := meta.View().Elements(); len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Error("Error: Wrong keys left in the container", keys)
+	}
+
+	// Exported as the deletes of the keys, not as a wildcard.
+	exported := writeCache.WildcardsToUnivalue()
+	if len(exported) != 2 || *exported[0].GetPath() != path+"b" || *exported[1].GetPath() != path+"d" || exported[0].Value() != nil {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+}
+
+func TestEraseByType(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+	writeCache.Write(1, path+"c", noncommutative.NewString("3")) // Pending
+	writeCache.Write(1, path+"d", noncommutative.NewInt64(4))
+	writeCache.Read(1, path+"a", new(noncommutative.Int64)) // Committed and loaded, "b" is committed only.
+
+	if removed, _, err := writeCache.EraseByType(1, path, noncommutative.INT64); err != nil || removed != 3 {
+		t.Fatal("Error: Wrong number of keys removed", removed, err)
+	}
+
+	for key, exists := range map[string]bool{"a": false, "b": false, "c": true, "d": false} {
+		if writeCache.IfExists(path+key) != exists {
+			t.Error("Error: Wrong existence", key)
+		}
+	}
+
+	// The type of "b" is looked up in the backend, it isn't loaded.
+	if _, ok := writeCache.GetIfCached(path + "b"); ok {
+		t.Error("Error: Shouldn't have been loaded")
+	}
+
+	// Only the one not loaded is exported as a wildcard delete, the others are deleted in the cache.
+	if exported := writeCache.WildcardsToUnivalue(); len(exported) != 1 || *exported[0].GetPath() != path+"b" || exported[0].Value() != nil {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+}
+
+func TestEraseIndexRange(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+	writeCache.Write(1, path+"c", noncommutative.NewInt64(3)) // Pending
+	writeCache.Write(1, path+"d", noncommutative.NewInt64(4))
+
+	// The committed "b" and the pending "c".
+	if removed, _, err := writeCache.EraseIndexRange(1, path, 1, 3); err != nil || removed != 2 {
+		t.Fatal("Error: Wrong number of keys removed", removed, err)
+	}
+
+	for key, exists := range map[string]bool{"a": true, "b": false, "c": false, "d": true} {
+		if writeCache.IfExists(path+key) != exists {
+			t.Error("Error: Wrong existence", key)
+		}
+	}
+
+	if exported := writeCache.WildcardsToUnivalue(); len(exported) != 1 || *exported[0].GetPath() != path+"b" || exported[0].Value() != nil {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+
+	if removed, _, err := writeCache.EraseIndexRange(1, path, 2, 5); err != nil || removed != 0 {
+		t.Error("Error: Nothing should be in the range", removed, err)
+	}
+}
+
+func TestErasePattern(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	writeCache := NewWriteCache(newCommittedContainer(path), 16, 1)
+	writeCache.Write(1, path+"c", noncommutative.NewInt64(3)) // Pending
+	writeCache.Write(1, path+"d", noncommutative.NewInt64(4))
+
+	// The pending ones are in the cache, so they are deleted directly.
+	if removed, _, err := writeCache.ErasePattern(1, path+"[2:]"); err != nil || removed != 2 {
+		t.Fatal("Error: Wrong number of keys removed", removed, err)
+	}
+
+	if writeCache.IfExists(path+"c") || writeCache.IfExists(path+"d") || !writeCache.IfExists(path+"b") {
+		t.Error("Error: Only the pending keys should have been removed")
+	}
+
+	if exported := writeCache.WildcardsToUnivalue(); len(exported) != 0 {
+		t.Error("Error: Nothing should be exported", exported)
+	}
+
+	if removed, _, err := writeCache.ErasePattern(1, path+"[:1]"); err != nil || removed != 1 || writeCache.IfExists(path+"a") {
+		t.Error("Error: The first key should have been removed", removed, err)
+	}
+
+	if exported := writeCache.WildcardsToUnivalue(); len(exported) != 1 || *exported[0].GetPath() != path+"a" {
+		t.Error("Error: Wrong wildcard export", exported)
+	}
+
+	if _, _, err := writeCache.ErasePattern(1, path+"[x:]"); err == nil {
+		t.Error("Error: Should have failed")
+	}
+}
+
+func TestParseIndexRange(t *testing.T) {
+	path := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	if p, from, to, err := ParseIndexRange(path + "[2:5]"); err != nil || p != path || from != 2 || to != 5 {
+		t.Error("Error: Wrong index range", p, from, to, err)
+	}
+
+	if _, from, to, err := ParseIndexRange(path + "[:]"); err != nil || from != 0 || to != math.MaxUint64 {
+		t.Error("Error: Wrong index range", from, to, err)
+	}
+
+	if _, _, _, err := ParseIndexRange(path + "[2]"); err == nil {
+		t.Error("Error: Should have failed")
+	}
+}
+
+func TestRemovedWithAncestor(t *testing.T) {
+	writeCache := NewWriteCache(nil, 16, 1)
+	root := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+
+	writeCache.updateTombstones(root+"a/x/y", noncommutative.NewInt64(1))
+	writeCache.updateTombstones(root+"a/*", nil) // Cleared with a wildcard, "a/" itself stays.
+
+	for _, path := range []string{root + "a/x/y", root + "a/x/", root + "a/b"} {
+		if !writeCache.RemovedWithAncestor(path) {
+			t.Error("Error: Should have been removed with the ancestor", path)
+		}
+	}
+
+	for _, path := range []string{root + "a/", root + "b/x", root} {
+		if writeCache.RemovedWithAncestor(path) {
+			t.Error("Error: Shouldn't have been removed", path)
+		}
+	}
+
+	// Written after the removal, it is back.
+	writeCache.updateTombstones(root+"a/x/z", noncommutative.NewInt64(2))
+	if writeCache.RemovedWithAncestor(root+"a/x/z") || !writeCache.RemovedWithAncestor(root+"a/x/y") {
+		t.Error("Error: Only the path written after the removal should be back")
+	}
+
+	// Removing a nested path hides it again.
+	writeCache.updateTombstones(root+"a/x/", nil)
+	if !writeCache.RemovedWithAncestor(root + "a/x/z") {
+		t.Error("Error: Should have been removed with the nested path")
+	}
+}
@@ -0,0 +1,248 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// arbitrator.go detects the read/write conflicts among the accesses of a transaction generation.
+// The accesses are usually the ones exported by WriteCache.ExportAll() or filtered by univalue.IPAccess.
+// The output is a list of conflicts, from which the committer whitelist can be derived directly.
+//
+
+package statestore
+
+import (
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+
+	mapi "github.com/arcology-network/common-lib/exp/map"
+	"github.com/arcology-network/common-lib/exp/slice"
+	indexer "github.com/arcology-network/common-lib/storage/indexer"
+	cache "github.com/arcology-network/storage-committer/storage/cache"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// Conflict records a path on which the accesses of some transactions conflict with the
+// first transaction that wrote to it.
+type Conflict struct {
+	Path   string   // The path where the conflict is detected.
+	Winner uint64   // The tx whose access is kept.
+	Losers []uint64 // The txs whose accesses conflict with the winner's.
+}
+
+type Conflicts []*Conflict
+
+// TxIDs returns the unique IDs of all the conflicting transactions in ascending order.
+func (this Conflicts) TxIDs() []uint64 {
+	dict := map[uint64]bool{}
+	for _, conflict := range this {
+		for _, tx := range conflict.Losers {
+			dict[tx] = true
+		}
+	}
+
+	txs := mapi.Keys(dict)
+	sort.Slice(txs, func(i, j int) bool { return txs[i] < txs[j] })
+	return txs
+}
+
+// Paths returns the paths on which conflicts have been detected.
+func (this Conflicts) Paths() []string {
+	return slice.Transform(this, func(_ int, v *Conflict) string { return v.Path })
+}
+
+// ByTx returns the paths involved for each of the conflicting transactions.
+func (this Conflicts) ByTx() map[uint64][]string {
+	dict := map[uint64][]string{}
+	for _, conflict := range this {
+		for _, tx := range conflict.Losers {
+			dict[tx] = append(dict[tx], conflict.Path)
+		}
+	}
+	return dict
+}
+
+// Arbitrator groups the accesses of a generation by path and checks them against each other.
+// The transactions are processed in the ascending order of their IDs, the first writer to a path
+// wins and all the later transactions accessing the same path lose, unless their accesses are commutative.
+type Arbitrator struct {
+	byPath *indexer.UnorderedIndexer[string, *univalue.Univalue, []*univalue.Univalue]
+	txs    map[uint64]bool // All the transactions seen in the imported accesses.
+}
+
+func NewArbitrator() *Arbitrator {
+	return &Arbitrator{
+		byPath: indexer.NewUnorderedIndexer(
+			nil,
+
+			// The accesses that are marked to skip the conflict check are ignored.
+			func(v *univalue.Univalue) (string, bool) {
+				if v.GetPath() == nil || v.IfSkipConflictCheck() || v.PathLookupOnly() {
+					return "", false
+				}
+				return *v.GetPath(), true
+			},
+
+			func(_ string, v *univalue.Univalue) []*univalue.Univalue { return []*univalue.Univalue{v} },
+			func(_ string, v *univalue.Univalue, vals *[]*univalue.Univalue) { *vals = append(*vals, v) },
+		),
+		txs: map[uint64]bool{},
+	}
+}
+
+// Import adds the accesses to the arbitrator. It can be called multiple times before Detect().
+func (this *Arbitrator) Import(accesses []*univalue.Univalue) *Arbitrator {
+	for _, v := range accesses {
+		if v != nil && !v.IfSkipConflictCheck() {
+			this.txs[v.GetTx()] = true
+		}
+	}
+	this.byPath.Import(accesses)
+	return this
+}
+
+// Detect checks all the imported accesses and returns the conflicts found.
+func (this *Arbitrator) Detect() Conflicts {
+	groups := this.byPath.Values()
+	conflicts := slice.ParallelTransform(groups, runtime.NumCPU(), func(_ int, accesses []*univalue.Univalue) *Conflict {
+		return this.detect(accesses)
+	})
+	slice.Remove(&conflicts, nil)
+	conflicts = append(conflicts, this.detectRanges(groups)...)
+
+	// Sort the conflicts by path so the output is deterministic.
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts
+}
+
+// Survivors returns the IDs of the transactions that don't have any conflicts in ascending order.
+func (this *Arbitrator) Survivors(conflicts Conflicts) []uint64 {
+	losers := mapi.FromSlice(conflicts.TxIDs(), func(_ uint64) bool { return true })
+	txs := mapi.Keys(this.txs)
+	slice.RemoveIf(&txs, func(_ int, tx uint64) bool {
+		_, ok := losers[tx]
+		return ok
+	})
+	sort.Slice(txs, func(i, j int) bool { return txs[i] < txs[j] })
+	return txs
+}
+
+// Clear resets the arbitrator for the next generation.
+func (this *Arbitrator) Clear() {
+	this.byPath.Clear()
+	clear(this.txs)
+}
+
+// Check the accesses to the same path. The accesses are sorted by tx first, all the accesses
+// before the first write are fine because they are consistent with the sequential order.
+func (this *Arbitrator) detect(accesses []*univalue.Univalue) *Conflict {
+	if len(accesses) <= 1 {
+		return nil
+	}
+	DeltaSequence(accesses).sort()
+
+	idx, _ := slice.FindFirstIf(accesses, func(_ int, v *univalue.Univalue) bool { return !v.IsReadOnly() })
+	if idx < 0 {
+		return nil // Read only
+	}
+
+	winner := accesses[idx]
+	losers := []uint64{}
+	for _, v := range accesses[idx+1:] {
+		if v.GetTx() == winner.GetTx() || IsCommutativeAccess(winner, v) {
+			continue
+		}
+
+		if len(losers) == 0 || losers[len(losers)-1] != v.GetTx() {
+			losers = append(losers, v.GetTx())
+		}
+	}
+
+	if len(losers) == 0 {
+		return nil
+	}
+	return &Conflict{Path: *winner.GetPath(), Winner: winner.GetTx(), Losers: losers}
+}
+
+// Check the range reads recorded by the container iterators against all the writes under the containers.
+// A range read loses if any earlier transaction has written to the container or anything under it.
+func (this *Arbitrator) detectRanges(groups [][]*univalue.Univalue) Conflicts {
+	slice.RemoveIf(&groups, func(_ int, accesses []*univalue.Univalue) bool { return len(accesses) == 0 })
+	sort.Slice(groups, func(i, j int) bool { return *groups[i][0].GetPath() < *groups[j][0].GetPath() })
+
+	conflicts := Conflicts{}
+	for _, accesses := range groups {
+		readers := slice.CopyIf(accesses, func(_ int, v *univalue.Univalue) bool { return cache.IsRangeRead(v) })
+		if len(readers) == 0 {
+			continue
+		}
+
+		// All the paths under the container are next to each other after sorting.
+		prefix := strings.TrimSuffix(*readers[0].GetPath(), "*")
+		first := sort.Search(len(groups), func(i int) bool { return *groups[i][0].GetPath() >= prefix })
+
+		writers := []uint64{}
+		for i := first; i < len(groups) && strings.HasPrefix(*groups[i][0].GetPath(), prefix); i++ {
+			for _, v := range groups[i] {
+				if !v.IsReadOnly() {
+					writers = append(writers, v.GetTx())
+				}
+			}
+		}
+
+		if len(writers) == 0 {
+			continue
+		}
+		_, winner := slice.Min(writers)
+
+		losers := []uint64{}
+		for _, v := range readers {
+			if v.GetTx() > winner {
+				losers = append(losers, v.GetTx())
+			}
+		}
+
+		if len(losers) > 0 {
+			slices.Sort(losers)
+			conflicts = append(conflicts, &Conflict{Path: *readers[0].GetPath(), Winner: winner, Losers: slices.Compact(losers)})
+		}
+	}
+	return conflicts
+}
+
+// IsCommutativeAccess checks if the two accesses to the same path can be merged without a conflict.
+// The rules are the same as the ones used when the transitions are finalized.
+func IsCommutativeAccess(lhv, rhv *univalue.Univalue) bool {
+	// Delta writes only, like Path element insertions or numeric delta updates.
+	if lhv.IsDeltaWriteOnly() && rhv.IsDeltaWriteOnly() {
+		return true
+	}
+
+	// Commutative numeric writes without any reads, the value limits must match.
+	if lhv.Value() != nil && rhv.Value() != nil {
+		return lhv.IsCumulativeWriteOnly(rhv) && rhv.IsCumulativeWriteOnly(lhv)
+	}
+	return false
+}
+
+// Arbitrate detects the conflicts among the accesses and returns the whitelist for Precommit() along with
+// the conflicts found.
+func (this *StateCommitter) Arbitrate(accesses []*univalue.Univalue) ([]uint64, Conflicts) {
+	arbitrator := NewArbitrator().Import(accesses)
+	conflicts := arbitrator.Detect()
+	return arbitrator.Survivors(conflicts), conflicts
+}
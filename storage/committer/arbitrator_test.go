@@ -0,0 +1,236 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arcology-network/common-lib/exp/slice"
+	"github.com/arcology-network/storage-committer/storage/cache"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+	"github.com/holiman/uint256"
+)
+
+func TestArbitratorReadWrite(t *testing.T) {
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(0, "blcc://eth1.0/account/alice/storage/native/0", 1, 0, 0, nil, nil), // Read before the write is fine.
+		univalue.NewUnivalue(1, "blcc://eth1.0/account/alice/storage/native/0", 0, 1, 0, noncommutative.NewInt64(1), nil),
+		univalue.NewUnivalue(2, "blcc://eth1.0/account/alice/storage/native/0", 1, 0, 0, nil, nil),
+		univalue.NewUnivalue(3, "blcc://eth1.0/account/alice/storage/native/0", 0, 1, 0, noncommutative.NewInt64(3), nil),
+		univalue.NewUnivalue(3, "blcc://eth1.0/account/alice/storage/native/1", 0, 1, 0, noncommutative.NewInt64(3), nil),
+	}
+
+	arbitrator := NewArbitrator().Import(accesses)
+	conflicts := arbitrator.Detect()
+	if len(conflicts) != 1 || conflicts[0].Winner != 1 {
+		t.Fatal("Error: Wrong number of conflicts", len(conflicts))
+	}
+
+	if txs := conflicts.TxIDs(); !reflect.DeepEqual(txs, []uint64{2, 3}) {
+		t.Error("Error: Wrong conflicting txs", txs)
+	}
+
+	if survivors := arbitrator.Survivors(conflicts); !reflect.DeepEqual(survivors, []uint64{0, 1}) {
+		t.Error("Error: Wrong survivors", survivors)
+	}
+}
+
+func TestArbitratorCommutative(t *testing.T) {
+	balance := "blcc://eth1.0/account/alice/balance"
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(1, balance, 0, 0, 1, commutative.NewU256Delta(uint256.NewInt(1), true), nil),
+		univalue.NewUnivalue(2, balance, 0, 0, 1, commutative.NewU256Delta(uint256.NewInt(2), true), nil),
+		univalue.NewUnivalue(3, balance, 0, 0, 1, commutative.NewU256Delta(uint256.NewInt(3), false), nil),
+	}
+
+	if conflicts := NewArbitrator().Import(accesses).Detect(); len(conflicts) != 0 {
+		t.Error("Error: Delta writes should not conflict")
+	}
+
+	// A read after the delta writes conflicts.
+	accesses = append(accesses, univalue.NewUnivalue(4, balance, 1, 0, 0, nil, nil))
+	if conflicts := NewArbitrator().Import(accesses).Detect(); !reflect.DeepEqual(conflicts.TxIDs(), []uint64{4}) {
+		t.Error("Error: The read should conflict with the delta writes")
+	}
+
+	// Conflict check skipped.
+	skipped := univalue.NewUnivalue(5, balance, 1, 1, 0, nil, nil)
+	skipped.SkipConflictCheck(true)
+	if conflicts := NewArbitrator().Import(accesses[:3]).Import([]*univalue.Univalue{skipped}).Detect(); len(conflicts) != 0 {
+		t.Error("Error: Skipped accesses should not be checked")
+	}
+}
+
+func TestArbitratorRegister(t *testing.T) {
+	bestBid := "blcc://eth1.0/account/alice/storage/container/bid/best"
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(1, bestBid, 0, 1, 0, commutative.NewMaxRegisterDelta(uint256.NewInt(5)), nil), // Created by two txs
+		univalue.NewUnivalue(2, bestBid, 0, 1, 0, commutative.NewMaxRegisterDelta(uint256.NewInt(7)), nil),
+		univalue.NewUnivalue(3, bestBid, 0, 0, 1, commutative.NewMaxRegisterDelta(uint256.NewInt(6)), nil),
+	}
+
+	if conflicts := NewArbitrator().Import(accesses).Detect(); len(conflicts) != 0 {
+		t.Error("Error: The register writes should not conflict", conflicts.TxIDs())
+	}
+
+	// A min register on the same path doesn't merge with the max ones.
+	accesses = append(accesses, univalue.NewUnivalue(4, bestBid, 0, 1, 0, commutative.NewMinRegisterDelta(uint256.NewInt(1)), nil))
+	if conflicts := NewArbitrator().Import(accesses).Detect(); len(conflicts) == 0 {
+		t.Error("Error: Should conflict")
+	}
+}
+
+func TestArbitratorGrowOnlySet(t *testing.T) {
+	allowlist := "blcc://eth1.0/account/alice/storage/container/allowlist"
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(1, allowlist, 0, 0, 1, commutative.NewGrowOnlySet("bob"), nil),
+		univalue.NewUnivalue(2, allowlist, 0, 0, 1, commutative.NewGrowOnlySet("bob", "carol"), nil),
+	}
+
+	if conflicts := NewArbitrator().Import(accesses).Detect(); len(conflicts) != 0 {
+		t.Error("Error: The adds should not conflict", conflicts.TxIDs())
+	}
+
+	// Checking the membership after the adds conflicts.
+	accesses = append(accesses, univalue.NewUnivalue(3, allowlist, 1, 0, 0, nil, nil))
+	if conflicts := NewArbitrator().Import(accesses).Detect(); !reflect.DeepEqual(conflicts.TxIDs(), []uint64{3}) {
+		t.Error("Error: The read should conflict with the adds")
+	}
+}
+
+func TestArbitratorRangeRead(t *testing.T) {
+	container := "blcc://eth1.0/account/alice/storage/container/ctrn/"
+	accesses := []*univalue.Univalue{
+		univalue.NewUnivalue(0, container+"*", 1, 0, 0, nil, nil), // Read before the write is fine.
+		univalue.NewUnivalue(1, container+"elem-0", 0, 1, 0, noncommutative.NewInt64(1), nil),
+		univalue.NewUnivalue(2, container+"*", 1, 0, 0, nil, nil),
+		univalue.NewUnivalue(3, "blcc://eth1.0/account/alice/storage/container/other/elem-0", 0, 1, 0, noncommutative.NewInt64(3), nil),
+	}
+
+	arbitrator := NewArbitrator().Import(accesses)
+	conflicts := arbitrator.Detect()
+	if len(conflicts) != 1 || conflicts[0].Path != container+"*" || conflicts[0].Winner != 1 {
+		t.Fatal("Error: Wrong conflicts", conflicts)
+	}
+
+	if survivors := arbitrator.Survivors(conflicts); !reflect.DeepEqual(survivors, []uint64{0, 1, 3}) {
+		t.Error("Error: Wrong survivors", survivors)
+	}
+}
+
+func TestArbitratorIterator(t *testing.T) {
+	container := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	committed := cache.NewWriteCache(nil, 16, 1)
+	meta := commutative.NewPath().(*commutative.Path)
+	meta.SetSubPaths([]string{"a"})
+	committed.AddToDict(univalue.NewUnivalue(0, container, 1, 0, 0, meta, nil))
+	committed.AddToDict(univalue.NewUnivalue(0, container+"a", 0, 1, 0, noncommutative.NewInt64(1), nil))
+
+	// Tx 1 iterates before tx 2 appends, tx 3 iterates after that.
+	caches := []*cache.WriteCache{cache.NewWriteCache(committed, 16, 1), cache.NewWriteCache(committed, 16, 1), cache.NewWriteCache(committed, 16, 1)}
+	if _, err := caches[0].Iterate(1, container, "", 0, false, new(noncommutative.Int64)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := caches[1].Write(2, container+"b", noncommutative.NewInt64(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := caches[2].Iterate(3, container, "", 0, false, new(noncommutative.Int64)); err != nil {
+		t.Fatal(err)
+	}
+
+	arbitrator := NewArbitrator()
+	for _, writeCache := range caches {
+		arbitrator.Import(writeCache.Export())
+	}
+
+	conflicts := arbitrator.Detect()
+	if !reflect.DeepEqual(conflicts.TxIDs(), []uint64{3}) {
+		t.Fatal("Error: Only the later iteration should conflict", conflicts.TxIDs())
+	}
+
+	if survivors := arbitrator.Survivors(conflicts); !reflect.DeepEqual(survivors, []uint64{1, 2}) {
+		t.Error("Error: Wrong survivors", survivors)
+	}
+}
+
+func TestArbitratorEraseAll(t *testing.T) {
+	container := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	committed := cache.NewWriteCache(nil, 16, 1)
+	meta := commutative.NewPath().(*commutative.Path)
+	meta.SetSubPaths([]string{"a", "b"})
+	committed.AddToDict(univalue.NewUnivalue(0, container, 1, 0, 0, meta, nil))
+	committed.AddToDict(univalue.NewUnivalue(0, container+"a", 0, 1, 0, noncommutative.NewInt64(1), nil))
+	committed.AddToDict(univalue.NewUnivalue(0, container+"b", 0, 1, 0, noncommutative.NewInt64(2), nil))
+
+	// Tx 1 clears the container while tx 2 appends to it.
+	eraser, appender := cache.NewWriteCache(committed, 16, 1), cache.NewWriteCache(committed, 16, 1)
+	if _, err := eraser.EraseAll(1, container); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := appender.Write(2, container+"c", noncommutative.NewInt64(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if conflicts := NewArbitrator().Import(eraser.Export()).Import(appender.Export()).Detect(); len(conflicts) != 0 {
+		t.Error("Error: Clearing the committed elements shouldn't conflict with the appends", conflicts.Paths())
+	}
+}
+
+func TestExpandWildcards(t *testing.T) {
+	root := "blcc://eth1.0/account/0x0000000000000000000000000000000000000001/storage/container/ctrn/"
+	store := cache.NewWriteCache(nil, 16, 1)
+	for path, keys := range map[string][]string{root: {"a", "ab", "b", "sub/"}, root + "sub/": {"x"}} {
+		meta := commutative.NewPath().(*commutative.Path)
+		meta.SetSubPaths(keys)
+		store.AddToDict(univalue.NewUnivalue(0, path, 1, 0, 0, meta, nil))
+	}
+	committer := &StateCommitter{readonlyStore: store}
+
+	all := []string{root + "a", root + "ab", root + "b", root + "sub/", root + "sub/x"}
+	if subs := committer.committedSubs(root); !slice.EqualSet(subs, all) {
+		t.Error("Error: Wrong committed descendants", subs)
+	}
+
+	if subs := committer.committedSubs(root + "none/"); subs != nil {
+		t.Error("Error: The path doesn't exist", subs)
+	}
+
+	expanded := committer.ExpandWildcards([]*univalue.Univalue{
+		univalue.NewUnivalue(3, root+"*", 0, 1, 0, nil, nil),  // All the descendants
+		univalue.NewUnivalue(4, root+"a*", 0, 1, 0, nil, nil), // The keys with the prefix
+		univalue.NewUnivalue(5, root+"b", 0, 1, 0, noncommutative.NewInt64(1), nil),
+	})
+
+	byTx := map[uint64][]string{}
+	for _, v := range expanded {
+		if v.IsExpanded() != (v.GetTx() != 5) || (v.GetTx() != 5 && v.Value() != nil) {
+			t.Error("Error: Wrong expanded transition", *v.GetPath())
+		}
+		byTx[v.GetTx()] = append(byTx[v.GetTx()], *v.GetPath())
+	}
+
+	if !slice.EqualSet(byTx[3], all) || !slice.EqualSet(byTx[4], []string{root + "a", root + "ab"}) || len(byTx[5]) != 1 {
+		t.Error("Error: Wrong expansion", byTx)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/arcology-network/common-lib/exp/slice"
+)
+
+// The phases in which a commit error can occur.
+const (
+	PHASE_FINALIZE   = "finalize"
+	PHASE_PRECOMMIT  = "precommit"
+	PHASE_COMMIT     = "commit"
+	PHASE_JOURNALING = "journaling"
+	PHASE_SIMULATE   = "simulate"
+)
+
+// CommitError is an error raised by a writer or on a path while committing a block.
+type CommitError struct {
+	Phase  string // One of the phases above.
+	Writer string // The name of the writer, empty if the error isn't from a writer.
+	Path   string // The path on which the error occurred, empty if it isn't path specific.
+	Err    error
+}
+
+func (this *CommitError) Error() string {
+	fields := []string{"phase: " + this.Phase}
+	if this.Writer != "" {
+		fields = append(fields, "writer: "+this.Writer)
+	}
+
+	if this.Path != "" {
+		fields = append(fields, "path: "+this.Path)
+	}
+	return strings.Join(fields, ", ") + ", " + this.Err.Error()
+}
+
+func (this *CommitError) Unwrap() error { return this.Err }
+
+type CommitErrors []*CommitError
+
+// Join combines all the errors into one, nil if there isn't any.
+func (this CommitErrors) Join() error {
+	return errors.Join(slice.Transform(this, func(_ int, v *CommitError) error { return v })...)
+}
+
+// ByWriter returns the errors from the writer.
+func (this CommitErrors) ByWriter(name string) CommitErrors {
+	return slice.CopyIf(this, func(_ int, v *CommitError) bool { return v.Writer == name })
+}
+
+// Paths returns the paths on which errors occurred.
+func (this CommitErrors) Paths() []string {
+	paths := []string{}
+	for _, v := range this {
+		if v.Path != "" {
+			paths = append(paths, v.Path)
+		}
+	}
+	return paths
+}
+
+// CommitResult contains the outcome of a block commit. The errors are collected from all the phases
+// since the last block, so the caller can decide to halt or retry the commit.
+type CommitResult struct {
+	BlockNum         uint64
+	EthRoot          [32]byte                 // The world trie root after the block, empty if there is no Eth storage writer.
+	Written          map[string]uint64        // The number of transitions written by each writer, by the writer name.
+	MergedSequences  uint64                   // The number of delta sequences with more than one transition merged.
+	LiveStorageBytes uint64                   // The bytes of the keys and encoded values written to the LiveStorage backend.
+	Timings          map[string]time.Duration // The time spent in each phase, by the phase name.
+	Errors           CommitErrors
+}
+
+// Err returns all the errors combined, nil if the block is committed successfully.
+func (this *CommitResult) Err() error { return this.Errors.Join() }
@@ -19,11 +19,18 @@
 package statestore
 
 import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/arcology-network/common-lib/common"
 	indexer "github.com/arcology-network/common-lib/storage/indexer"
 	stgcommon "github.com/arcology-network/storage-committer/common"
 	platform "github.com/arcology-network/storage-committer/platform"
 	cache "github.com/arcology-network/storage-committer/storage/cache"
+	ccstorage "github.com/arcology-network/storage-committer/storage/livestorage"
 	"github.com/arcology-network/storage-committer/type/univalue"
 
 	mapi "github.com/arcology-network/common-lib/exp/map"
@@ -53,7 +60,16 @@ type StateCommitter struct {
 	byPath *indexer.UnorderedIndexer[string, *univalue.Univalue, []*univalue.Univalue]
 	byTxID *indexer.UnorderedIndexer[uint64, *univalue.Univalue, []*univalue.Univalue]
 
-	Err error
+	generation uint64                 // The number of generations precommitted in the current block.
+	finalized  [][]*univalue.Univalue // The finalized transitions of each generation in the current block.
+	journal    *CommitJournal         // Optional, the write-ahead log for crash-consistent commits.
+	errs       CommitErrors           // The errors collected since the last block commit.
+
+	merged  atomic.Uint64            // The number of delta sequences merged in the current block.
+	timings map[string]time.Duration // The time spent in each phase in the current block.
+
+	subscribers subscribers // The subscribers to the state diffs of the blocks.
+	pipeline    *pipeline   // Optional, commits the blocks with the asynchronous writers in the background.
 }
 
 // NewStateCommitter creates a new StateCommitter instance. The stores are the stores that can be isCommitted.
@@ -68,6 +84,7 @@ func NewStateCommitter(readonlyStore stgcommon.ReadOnlyStore, writers []stgcommo
 		writers: writers,
 		byPath:  PathIndexer(readonlyStore), // By storage path
 		byTxID:  TxIndexer(readonlyStore),   // By tx ID, used to quickly remove the transitions that are not in the whitelist.
+		timings: map[string]time.Duration{},
 	}
 
 	// Filter the writers into synchronous first.
@@ -94,8 +111,8 @@ func (this *StateCommitter) SetStore(store stgcommon.ReadOnlyStore) { // Testing
 }
 
 // Import imports the given transitions into the StateCommitter.
-func (this *StateCommitter) Import(transitions []*univalue.Univalue) *StateCommitter {
-	// transitions := rawTrans //this.ExpandWildcards(rawTrans) // Import the wildcards, if any.
+func (this *StateCommitter) Import(rawTrans []*univalue.Univalue) *StateCommitter {
+	transitions := this.ExpandWildcards(rawTrans) // Import the wildcards, if any.
 
 	// Import the regular transitions to the indexers.
 	this.byPath.Import(transitions)
@@ -124,95 +141,382 @@ func (this *StateCommitter) whitelist(txs []uint64) *StateCommitter {
 	return this
 }
 
-// Commit commits the transitions to stores.
-func (this *StateCommitter) Finalize(txs []uint64) {
+// Finalize merges the transitions of the whitelisted transactions by path. The paths
+// on which the deltas can't be applied are reported in the returned error.
+func (this *StateCommitter) Finalize(txs []uint64) error {
 	this.whitelist(txs) // Mark the transitions that are not in the whitelist
 
 	// Finalize all the transitions by merging the transitions
 	// for both the ETH storage and the concurrent container transitions
-	this.byPath.ParallelForeachDo(func(_ string, v *[]*univalue.Univalue) {
+	defer this.timed(PHASE_FINALIZE, time.Now())
+
+	var lock sync.Mutex
+	errs := CommitErrors{}
+	this.byPath.ParallelForeachDo(func(path string, v *[]*univalue.Univalue) {
 		slice.RemoveIf(v, func(_ int, val *univalue.Univalue) bool { return val.GetPath() == nil }) // Remove conflicting ones.
-		if len(*v) > 0 {
-			// Finalize the transitions and flag the merged ones.
-			DeltaSequence(*v).Finalize(this.readonlyStore) // Sort and finalize the transitions.
+		if len(*v) == 0 {
+			return
+		}
+
+		if len(*v) > 1 {
+			this.merged.Add(1)
+		}
+
+		// Finalize the transitions and flag the merged ones.
+		if _, err := DeltaSequence(*v).Finalize(this.readonlyStore); err != nil {
+			lock.Lock()
+			errs = append(errs, &CommitError{Phase: PHASE_FINALIZE, Path: path, Err: err})
+			lock.Unlock()
 		}
 	})
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	this.errs = append(this.errs, errs...)
+
+	// Keep the finalized transitions of the generation, the merged ones have been flagged.
+	finalized := []*univalue.Univalue{}
+	for _, vals := range this.byPath.Values() {
+		if len(vals) > 0 && vals[0].GetPath() != nil {
+			finalized = append(finalized, vals[0])
+		}
+	}
 
 	// Import the affiliated deletes, no need to finalize them because they are already finalized.
-	// this.Import(GetCascadeSub)
+	cascades := this.CascadeDelete(finalized)
+	for _, writer := range this.writers {
+		writer.Import(cascades)
+	}
+	this.finalized = append(this.finalized, append(finalized, cascades...))
+
+	// The state diffs are only needed when there are subscribers.
+	var diffs []*StateDiff
+	if this.subscribed() {
+		diffs = this.diff(cascades)
+	}
+	this.subscribers.diffs = append(this.subscribers.diffs, diffs)
 
 	this.byPath.Clear()
 	this.byTxID.Clear()
+	return errs.Join()
 }
 
-func (this *StateCommitter) CascadeDelete(txs []uint64) {
-	// When deleting a path, all the sub paths are also deleted. But deleted sub paths aren't part of the transitions.
-	// to save bandwidth, we need generate these transitions here.
-	// GetCascadeSub := []*univalue.Univalue{}
-	// this.byPath.ForeachDo(func(_ string, v []*univalue.Univalue) {
-	// 	if v[0].TypeID() == commutative.PATH && v[0].Value() == nil {
-	// 		for _, k := range v[0].Value().(*softdeltaset.DeltaSet[string]).Elements() {
-	// 			key := *(v[0].Property.GetPath()) + k // Concatenate the path and the subkey
-	// 			v := univalue.NewUnivalue(v[0].GetTx(), key, 0, 1, 0, nil, nil)
-	// 			GetCascadeSub = append(GetCascadeSub, v)
-	// 		}
-	// 	}
-	// })
+// CascadeDelete generates the delete transitions for all the descendants of the deleted containers.
+// When deleting a path, all the sub paths are also deleted. But deleted sub paths aren't part of the transitions
+// to save bandwidth, so they are generated here from the committed container, which is still in the store
+// because the finalized transitions haven't been precommitted yet. The paths that already have transitions are skipped.
+func (this *StateCommitter) CascadeDelete(finalized []*univalue.Univalue) []*univalue.Univalue {
+	existing := map[string]bool{}
+	deleted := []*univalue.Univalue{}
+	for _, v := range finalized {
+		existing[*v.GetPath()] = true
+		if v.Value() == nil && common.IsPath(*v.GetPath()) {
+			deleted = append(deleted, v)
+		}
+	}
+
+	cascades := []*univalue.Univalue{}
+	for _, v := range deleted {
+		// Nothing if the container was created and deleted in the same block.
+		for _, key := range this.committedSubs(*v.GetPath()) {
+			if existing[key] {
+				continue
+			}
+			existing[key] = true
+
+			sub := univalue.NewUnivalue(v.GetTx(), key, 0, 1, 0, nil, nil)
+			sub.SetBlockBound(v.IsBlockBound())
+			cascades = append(cascades, sub)
+		}
+	}
+	return cascades
 }
 
 // Commit commits the transitions in the StateCommitter.
 // 1. For the block write cache, it commits the transitions to the cache.
 // 2. For the eth storage, it updates the tries without committing the transitions to the DB
-func (this *StateCommitter) Precommit(txs []uint64) *StateCommitter {
-	this.Finalize(txs)
-	this.SyncPrecommit()
-	this.AsyncPrecommit()
-	return this
+// The generation is dropped if it fails to finalize, so no partial state is precommitted. Otherwise, the errors
+// from the writers are returned together and the generation is precommitted regardless.
+func (this *StateCommitter) Precommit(txs []uint64) error {
+	if err := this.Finalize(txs); err != nil {
+		this.revert(this.generation) // Discard the transitions imported for the generation.
+		return err
+	}
+
+	return errors.Join(
+		this.SyncPrecommit(),
+		this.AsyncPrecommit(),
+	)
 }
 
 // Only the global write cache needs to be synchronized before the next precommit or commit.
-func (this *StateCommitter) SyncPrecommit() {
-	slice.ParallelForeach(this.writers, len(this.writers),
-		func(i int, writer *stgcommon.Writer[*univalue.Univalue]) {
-			// Eth storage only serves user API enquiries. It has nothing to do with the
-			// transitions execution. So we do not need to precommit it synchronously.
-			if !common.IsType[*ethstorage.EthStorageWriter](*writer) {
-				(*writer).Precommit(true)
-			}
-		})
+func (this *StateCommitter) SyncPrecommit() error {
+	defer this.timed(PHASE_PRECOMMIT, time.Now())
+	return this.run(PHASE_PRECOMMIT, this.writers, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		// Eth storage only serves user API enquiries. It has nothing to do with the
+		// transitions execution. So we do not need to precommit it synchronously.
+		if !common.IsType[*ethstorage.EthStorageWriter](writer) {
+			return writer.Precommit(true)
+		}
+		return nil
+	})
 }
 
 // Only the global write cache needs to be synchronized before the next precommit or commit.
-func (this *StateCommitter) AsyncPrecommit() {
+// A generation is completed when the asynchronous precommit is done.
+func (this *StateCommitter) AsyncPrecommit() error {
+	defer this.timed(PHASE_PRECOMMIT, time.Now())
+	err := this.run(PHASE_PRECOMMIT, this.writers, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		if !common.IsType[*cache.ExecutionCacheWriter](writer) {
+			return writer.Precommit(false)
+		}
+		return nil
+	})
+	this.generation++
+	return err
+}
+
+// Generation returns the number of generations precommitted in the current block.
+// It is also the ID of the next generation to be precommitted.
+func (this *StateCommitter) Generation() uint64 { return this.generation }
+
+// RevertGeneration undoes a precommitted generation of the current block. Since the later generations
+// are built on top of it, they are reverted as well. The writers are restored to their states before the
+// generation and the transitions imported but not precommitted yet are discarded.
+func (this *StateCommitter) RevertGeneration(gen uint64) error {
+	if gen >= this.generation {
+		return errors.New("Error: The generation hasn't been precommitted yet")
+	}
+	this.revert(gen)
+	return nil
+}
+
+// Restore the writers to the states before the generation and drop everything imported after that.
+func (this *StateCommitter) revert(gen uint64) {
+	this.byPath.Clear()
+	this.byTxID.Clear()
+
 	slice.ParallelForeach(this.writers, len(this.writers),
 		func(_ int, writer *stgcommon.Writer[*univalue.Univalue]) {
-			if !common.IsType[*cache.ExecutionCacheWriter](*writer) {
-				(*writer).Precommit(false)
-			}
+			(*writer).RevertGeneration(gen)
 		})
+	this.generation = gen
+	this.finalized = this.finalized[:min(int(gen), len(this.finalized))]
+	this.subscribers.diffs = this.subscribers.diffs[:min(int(gen), len(this.subscribers.diffs))]
 }
 
-// Commit commits the transitions to different stores.
-// This is mainly for degugging purposes. The two functions should
-// be called separately, one for synchronous commit and one for asynchronous commit.
-func (this *StateCommitter) Commit(blockNum uint64) *StateCommitter {
-	this.SyncCommit(blockNum)
-	this.AsyncCommit(blockNum)
-	return this
+// Commit commits the transitions to different stores and returns the result of the block.
+// The two functions can also be called separately, one for synchronous commit and one for
+// asynchronous commit, followed by Result(). The asynchronous commit is skipped if the synchronous one fails.
+func (this *StateCommitter) Commit(blockNum uint64) *CommitResult {
+	if err := this.SyncCommit(blockNum); err == nil {
+		this.AsyncCommit(blockNum)
+	}
+	return this.Result(blockNum)
 }
 
 // Only the global write cache needs to be synchronized before the next precommit.
-func (this *StateCommitter) SyncCommit(blockNum uint64) {
-	slice.ParallelForeach(this.syncWriters, len(this.syncWriters),
-		func(_ int, writer *stgcommon.Writer[*univalue.Univalue]) {
-			(*writer).Commit(blockNum)
-		})
+// No generation can be reverted once the block is committed. With a journal, the finalized transitions
+// are recorded first, if that fails, nothing is committed. Since the journal holds one block at a time, in
+// the pipelined mode, it waits for the blocks still being committed in the background before recording.
+func (this *StateCommitter) SyncCommit(blockNum uint64) error {
+	// A block retried after a failed asynchronous commit is recorded already, the finalized transitions are gone by now.
+	if this.journal != nil && !this.journal.IsPending(blockNum) {
+		t0 := time.Now()
+		err := this.journal.Begin(blockNum, this.Finalized())
+		this.timed(PHASE_JOURNALING, t0)
+
+		if err != nil {
+			this.errs = append(this.errs, &CommitError{Phase: PHASE_JOURNALING, Err: err})
+			return err
+		}
+	}
+	defer this.timed(PHASE_COMMIT, time.Now())
+
+	err := this.run(PHASE_COMMIT, this.syncWriters, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		return writer.Commit(blockNum)
+	})
+
+	if this.subscribed() {
+		this.hold(this.blockDiff(blockNum))
+	}
+	this.subscribers.diffs = this.subscribers.diffs[:0]
+
+	this.generation = 0
+	this.finalized = this.finalized[:0]
+	return err
 }
 
 // Only the global write cache needs to be synchronized before the next precommit.
-func (this *StateCommitter) AsyncCommit(blockNum uint64) {
-	slice.ParallelForeach(this.asyncWriters, len(this.asyncWriters),
-		func(_ int, writer *stgcommon.Writer[*univalue.Univalue]) {
-			(*writer).Commit(blockNum)
+// The block is marked as committed in the journal once all the writers are done. If any of them
+// fails, the block stays in the journal, it can be retried or will be replayed on restart.
+// In the pipelined mode, the block is queued and committed in the background, see WaitCommitted().
+func (this *StateCommitter) AsyncCommit(blockNum uint64) error {
+	if this.pipeline != nil {
+		defer this.timed(PHASE_COMMIT, time.Now())
+		return this.enqueue(blockNum)
+	}
+
+	t0 := time.Now()
+	err := this.run(PHASE_COMMIT, this.asyncWriters, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		return writer.Commit(blockNum)
+	})
+	this.timed(PHASE_COMMIT, t0)
+
+	if this.journal != nil && err == nil {
+		t0 := time.Now()
+		if err = this.journal.End(blockNum); err != nil {
+			this.errs = append(this.errs, &CommitError{Phase: PHASE_JOURNALING, Err: err})
+		}
+		this.timed(PHASE_JOURNALING, t0)
+	}
+
+	if err == nil {
+		this.publish() // The block is fully committed, deliver the diffs.
+	}
+	return err
+}
+
+// Result returns the outcome of the block with all the errors and stats collected since the last one,
+// then resets them for the next block. The writer stats are from their commits of the block, a writer that
+// failed reports nothing. In the pipelined mode, the writers committing in the background aren't included.
+func (this *StateCommitter) Result(blockNum uint64) *CommitResult {
+	result := &CommitResult{
+		BlockNum:        blockNum,
+		Written:         map[string]uint64{},
+		MergedSequences: this.merged.Load(),
+		Timings:         this.timings,
+		Errors:          this.errs,
+	}
+
+	for _, writer := range this.writers {
+		if ethWriter, ok := writer.(*ethstorage.EthStorageWriter); ok {
+			result.EthRoot = ethWriter.Root()
+		}
+
+		if stats, ok := writer.(stgcommon.WriterStats); ok {
+			count, bytes := stats.Written()
+			result.Written[writer.Name()] = count
+			if common.IsType[*ccstorage.LiveStorageWriter](writer) {
+				result.LiveStorageBytes += bytes
+			}
+		}
+	}
+
+	this.errs = CommitErrors{}
+	this.merged.Store(0)
+	this.timings = map[string]time.Duration{}
+	return result
+}
+
+// Accumulate the time spent in the phase since t0.
+func (this *StateCommitter) timed(phase string, t0 time.Time) {
+	if this.timings == nil {
+		this.timings = map[string]time.Duration{}
+	}
+	this.timings[phase] += time.Since(t0)
+}
+
+// Errors returns the errors collected since the last block.
+func (this *StateCommitter) Errors() CommitErrors { return this.errs }
+
+// Call the writers in parallel and collect the errors along with the names of the writers.
+func (this *StateCommitter) run(phase string, writers []stgcommon.Writer[*univalue.Univalue], do func(stgcommon.Writer[*univalue.Univalue]) error) error {
+	errs := make(CommitErrors, len(writers))
+	slice.ParallelForeach(writers, len(writers),
+		func(i int, writer *stgcommon.Writer[*univalue.Univalue]) {
+			if err := do(*writer); err != nil {
+				errs[i] = &CommitError{Phase: phase, Writer: (*writer).Name(), Err: err}
+			}
 		})
+	slice.Remove(&errs, nil)
+	this.errs = append(this.errs, errs...)
+	return errs.Join()
+}
+
+// Finalized returns the finalized transitions to be persisted in the current block. If a path has been
+// updated in multiple generations, only the transition from the last one is kept because it is built on top
+// of the previous ones. The block bound transitions are excluded.
+func (this *StateCommitter) Finalized() []*univalue.Univalue {
+	positions := map[string]int{}
+	finalized := []*univalue.Univalue{}
+	for _, generation := range this.finalized {
+		for _, v := range generation {
+			if v.GetPath() == nil || v.IsBlockBound() {
+				continue
+			}
+
+			if idx, ok := positions[*v.GetPath()]; ok {
+				finalized[idx] = v
+				continue
+			}
+			positions[*v.GetPath()] = len(finalized)
+			finalized = append(finalized, v)
+		}
+	}
+	return finalized
+}
+
+// SetJournal enables the write-ahead log. It should be set before the first block is committed
+// and followed by Recover() to bring the writers to a consistent block.
+func (this *StateCommitter) SetJournal(journal *CommitJournal) *StateCommitter {
+	this.journal = journal
+	return this
+}
+
+// Journal returns the write-ahead log, nil if it isn't enabled.
+func (this *StateCommitter) Journal() *CommitJournal { return this.journal }
+
+// Recover replays the blocks left unfinished by a crash in order. The recorded transitions are final values,
+// so they are handed over to all the writers directly without going through the finalization again.
+// Writers that had committed a block before the crash simply write the same values again. A corrupted
+// record is discarded along with the ones after it. It returns the last consistent block number.
+func (this *StateCommitter) Recover() (uint64, error) {
+	if this.journal == nil {
+		return 0, errors.New("Error: The journal isn't enabled")
+	}
+
+	for {
+		blockNum, transitions, err := this.journal.Pending()
+		if transitions == nil {
+			lastBlock, _ := this.journal.LastBlock()
+			return lastBlock, errors.Join(err, this.journal.Discard())
+		}
+
+		if err := this.replay(blockNum, transitions); err != nil {
+			lastBlock, _ := this.journal.LastBlock()
+			return lastBlock, err // Keep the records for the next attempt.
+		}
+	}
+}
+
+// Replay a recorded block with all the writers.
+func (this *StateCommitter) replay(blockNum uint64, transitions []*univalue.Univalue) error {
+	for _, writer := range this.writers {
+		writer.Import(transitions)
+	}
+
+	commit := func(writer stgcommon.Writer[*univalue.Univalue]) error { return writer.Commit(blockNum) }
+	err := errors.Join(
+		this.SyncPrecommit(),
+		this.AsyncPrecommit(),
+		this.run(PHASE_COMMIT, this.syncWriters, commit),
+		this.run(PHASE_COMMIT, this.asyncWriters, commit),
+	)
+	this.generation = 0
+	this.finalized = this.finalized[:0]
+	this.Result(blockNum) // Reset the errors and stats, they are returned already.
+
+	if err != nil {
+		return err
+	}
+	return this.journal.End(blockNum)
+}
+
+// TxStateDiffs returns what each of the transactions changed in the prestate/poststate format. The prestate
+// values are read from the store the transactions were executed against, so it should be called before
+// the transitions are precommitted.
+func (this *StateCommitter) TxStateDiffs(transitions []*univalue.Univalue) []*cache.TxStateDiff {
+	return cache.TxStateDiffs(transitions, func(_ uint64, path string, T any) any {
+		v, _ := this.readonlyStore.Retrive(path, T)
+		return v
+	})
 }
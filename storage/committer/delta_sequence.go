@@ -52,21 +52,23 @@ func (this DeltaSequence) sort() DeltaSequence {
 	return this
 }
 
-func (this DeltaSequence) Finalize(store stgcommon.ReadOnlyStore) *univalue.Univalue {
+// Finalize merges the transitions into the first one. If the deltas can't be applied, the error is
+// returned and none of the transitions is flagged as merged.
+func (this DeltaSequence) Finalize(store stgcommon.ReadOnlyStore) (*univalue.Univalue, error) {
 	trans := []*univalue.Univalue(this)
 	slice.RemoveIf(&trans, func(_ int, v *univalue.Univalue) bool {
 		return v.GetPath() == nil
 	})
 
 	if len(this) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	this.sort()
 
 	// Use the first transition as the base value to apply the delta sets.
 	if err := this[0].ApplyDelta(this[1:]); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Remove the transition to indicate that the delta sequence has been finalized
@@ -75,7 +77,7 @@ func (this DeltaSequence) Finalize(store stgcommon.ReadOnlyStore) *univalue.Univ
 	}
 
 	this = this[:1]
-	return this[0]
+	return this[0], nil
 }
 
 func (this DeltaSequence) Finalized() *univalue.Univalue { return this[0] }
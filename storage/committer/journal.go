@@ -0,0 +1,236 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// journal.go implements a block level write-ahead log for the committer. The finalized transitions of a block
+// are recorded before they are handed over to the writers. If the node crashes before all the writers are done,
+// the block is replayed on startup, so the live storage and the Ethereum trie end up at the same block number.
+// Each block has its own record, so a block can be recorded while the earlier ones are still being committed
+// in the background.
+//
+
+package statestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+const (
+	JOURNAL_PENDING_FILE   = "pending.wal" // The finalized transitions of a block being committed, suffixed with the block number.
+	JOURNAL_COMMITTED_FILE = "committed"   // The number of the last block fully committed by all the writers.
+
+	journalHeaderSize = 8 + sha256.Size // Block number + checksum of the payload
+)
+
+// CommitJournal records the finalized transitions of a block before they are committed,
+// and the last block number that has been committed by all the writers.
+type CommitJournal struct {
+	lock      sync.Mutex // Blocks are ended by the pipeline while the next ones are recorded.
+	dir       string
+	lastBlock uint64
+	hasBlock  bool            // If any block has ever been committed through the journal.
+	pending   map[uint64]bool // The blocks recorded by Begin() and not ended yet.
+}
+
+// NewCommitJournal opens or creates a commit journal in the directory.
+func NewCommitJournal(dir string) (*CommitJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	journal := &CommitJournal{dir: dir, pending: map[uint64]bool{}}
+	buffer, err := os.ReadFile(filepath.Join(dir, JOURNAL_COMMITTED_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return journal, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buffer) != 8 {
+		return nil, errors.New("Error: The committed block number in the journal is corrupted")
+	}
+
+	journal.lastBlock = binary.LittleEndian.Uint64(buffer)
+	journal.hasBlock = true
+	return journal, nil
+}
+
+// LastBlock returns the number of the last block committed by all the writers. The second return
+// value is false if no block has been committed yet.
+func (this *CommitJournal) LastBlock() (uint64, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.lastBlock, this.hasBlock
+}
+
+// Begin records the finalized transitions of the block. It must be done before any of the writers starts committing.
+func (this *CommitJournal) Begin(blockNum uint64, transitions []*univalue.Univalue) error {
+	payload := univalue.Univalues(transitions).Encode()
+	checksum := sha256.Sum256(payload)
+
+	buffer := make([]byte, journalHeaderSize, journalHeaderSize+len(payload))
+	binary.LittleEndian.PutUint64(buffer, blockNum)
+	copy(buffer[8:], checksum[:])
+	if err := this.writeFile(pendingFile(blockNum), append(buffer, payload...)); err != nil {
+		return err
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.pending[blockNum] = true
+	return nil
+}
+
+// IsPending checks if the block has been recorded by Begin() and hasn't been ended or discarded yet.
+func (this *CommitJournal) IsPending(blockNum uint64) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.pending[blockNum]
+}
+
+// End marks the block as committed by all the writers and removes its recorded transitions.
+// The blocks must be ended in order.
+func (this *CommitJournal) End(blockNum uint64) error {
+	buffer := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buffer, blockNum)
+	if err := this.writeFile(JOURNAL_COMMITTED_FILE, buffer); err != nil {
+		return err
+	}
+
+	this.lock.Lock()
+	this.lastBlock, this.hasBlock = blockNum, true
+	delete(this.pending, blockNum)
+	this.lock.Unlock()
+
+	if err := os.Remove(filepath.Join(this.dir, pendingFile(blockNum))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Pending returns the oldest block that has been recorded but not fully committed. The transitions are nil
+// if there is nothing to replay. A record that is incomplete or corrupted returns no transitions, it should
+// be discarded along with the ones after it. The records of the blocks committed already are skipped.
+func (this *CommitJournal) Pending() (uint64, []*univalue.Univalue, error) {
+	blockNums, err := this.records()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	lastBlock, hasBlock := this.LastBlock()
+	if pos := slices.IndexFunc(blockNums, func(blockNum uint64) bool { return !hasBlock || blockNum > lastBlock }); pos >= 0 {
+		return this.read(blockNums[pos])
+	}
+	return 0, nil, nil
+}
+
+// Read the record of the block.
+func (this *CommitJournal) read(blockNum uint64) (uint64, []*univalue.Univalue, error) {
+	buffer, err := os.ReadFile(filepath.Join(this.dir, pendingFile(blockNum)))
+	if err != nil {
+		return blockNum, nil, err
+	}
+
+	if len(buffer) < journalHeaderSize {
+		return blockNum, nil, errors.New("Error: Incomplete journal record")
+	}
+
+	payload := buffer[journalHeaderSize:]
+	if checksum := sha256.Sum256(payload); binary.LittleEndian.Uint64(buffer) != blockNum || !bytes.Equal(checksum[:], buffer[8:journalHeaderSize]) {
+		return blockNum, nil, errors.New("Error: Journal record checksum mismatched")
+	}
+	return blockNum, univalue.Univalues{}.Decode(payload).(univalue.Univalues), nil
+}
+
+// Discard removes all the pending records.
+func (this *CommitJournal) Discard() error {
+	blockNums, err := this.records()
+	for _, blockNum := range blockNums {
+		if e := os.Remove(filepath.Join(this.dir, pendingFile(blockNum))); e != nil && !errors.Is(e, os.ErrNotExist) {
+			err = errors.Join(err, e)
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	clear(this.pending)
+	return err
+}
+
+// The block numbers of the records in the directory in ascending order.
+func (this *CommitJournal) records() ([]uint64, error) {
+	entries, err := os.ReadDir(this.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blockNums := []uint64{}
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), JOURNAL_PENDING_FILE+".")
+		if blockNum, err := strconv.ParseUint(suffix, 10, 64); ok && err == nil {
+			blockNums = append(blockNums, blockNum)
+		}
+	}
+	slices.Sort(blockNums)
+	return blockNums, nil
+}
+
+// The record file of the block.
+func pendingFile(blockNum uint64) string {
+	return JOURNAL_PENDING_FILE + "." + strconv.FormatUint(blockNum, 10)
+}
+
+// Write to a temporary file first and then rename it, so a record is either fully written or not at all.
+func (this *CommitJournal) writeFile(name string, data []byte) error {
+	target := filepath.Join(this.dir, name)
+	file, err := os.OpenFile(target+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if err = errors.Join(err, file.Close()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(target+".tmp", target); err != nil {
+		return err
+	}
+
+	// Flush the directory entry as well, otherwise the rename may be lost on a crash.
+	if dir, err := os.Open(this.dir); err == nil {
+		err = dir.Sync()
+		return errors.Join(err, dir.Close())
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestCommitJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := NewCommitJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := journal.LastBlock(); ok {
+		t.Error("Error: No block should have been committed")
+	}
+
+	transitions := []*univalue.Univalue{
+		univalue.NewUnivalue(1, "blcc://eth1.0/account/alice/storage/native/0", 0, 1, 0, noncommutative.NewInt64(1), nil),
+		univalue.NewUnivalue(2, "blcc://eth1.0/account/alice/storage/native/1", 0, 1, 0, noncommutative.NewInt64(2), nil),
+	}
+
+	if err := journal.Begin(5, transitions); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen as if the node had crashed before the writers were done.
+	journal, _ = NewCommitJournal(dir)
+	blockNum, pending, err := journal.Pending()
+	if err != nil || blockNum != 5 || len(pending) != 2 || *pending[1].GetPath() != *transitions[1].GetPath() {
+		t.Fatal("Error: Failed to load the pending block", err)
+	}
+
+	if err := journal.End(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if blockNum, ok := journal.LastBlock(); !ok || blockNum != 5 {
+		t.Error("Error: Wrong last block", blockNum)
+	}
+
+	if _, pending, _ := journal.Pending(); pending != nil {
+		t.Error("Error: The pending record should have been removed")
+	}
+
+	// The next blocks can be recorded before the earlier ones are committed, the oldest one is replayed first.
+	journal.Begin(6, transitions)
+	journal.Begin(7, transitions[:1])
+	if blockNum, pending, _ := journal.Pending(); blockNum != 6 || len(pending) != 2 {
+		t.Fatal("Error: Block 6 should be replayed first", blockNum)
+	}
+
+	journal.End(6)
+	if blockNum, pending, _ := journal.Pending(); blockNum != 7 || len(pending) != 1 || !journal.IsPending(7) {
+		t.Fatal("Error: Block 7 should still be pending", blockNum)
+	}
+
+	// A corrupted record is rejected.
+	buffer, _ := os.ReadFile(filepath.Join(dir, pendingFile(7)))
+	buffer[len(buffer)-1] ^= 0xff
+	os.WriteFile(filepath.Join(dir, pendingFile(7)), buffer, 0644)
+
+	if _, pending, err := journal.Pending(); pending != nil || err == nil {
+		t.Error("Error: The corrupted record should be rejected")
+	}
+
+	if journal.Discard(); journal.IsPending(7) {
+		t.Error("Error: The records should have been discarded")
+	}
+}
+
+// An asynchronous writer that fails to commit while failing is set.
+type failingWriter struct{ failing bool }
+
+func (this *failingWriter) Import([]*univalue.Univalue) {}
+func (this *failingWriter) Precommit(bool) error        { return nil }
+func (this *failingWriter) RevertGeneration(uint64)     {}
+func (this *failingWriter) IsSync() bool                { return false }
+func (this *failingWriter) Name() string                { return "Failing Writer" }
+func (this *failingWriter) Commit(uint64) error {
+	if this.failing {
+		return errors.New("Error: Failed to commit")
+	}
+	return nil
+}
+
+func TestCommitJournalRetry(t *testing.T) {
+	journal, err := NewCommitJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &failingWriter{failing: true}
+	committer := (&StateCommitter{asyncWriters: []stgcommon.Writer[*univalue.Univalue]{writer}}).SetJournal(journal)
+	committer.finalized = [][]*univalue.Univalue{{
+		univalue.NewUnivalue(1, "blcc://eth1.0/account/alice/storage/native/0", 0, 1, 0, noncommutative.NewInt64(1), nil),
+	}}
+
+	if err := committer.SyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := committer.AsyncCommit(5); err == nil {
+		t.Fatal("Error: The asynchronous commit should have failed")
+	}
+
+	// The retry mustn't overwrite the record with the finalized transitions cleared by the first attempt.
+	writer.failing = false
+	if err := committer.SyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if blockNum, pending, _ := journal.Pending(); blockNum != 5 || len(pending) != 1 {
+		t.Fatal("Error: The pending record should have been kept", blockNum, len(pending))
+	}
+
+	if err := committer.AsyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if blockNum, ok := journal.LastBlock(); !ok || blockNum != 5 || journal.IsPending(5) {
+		t.Error("Error: The block should have been committed", blockNum)
+	}
+}
+
+// A pipelined writer, the blocks committed in the background fail while failing is set.
+type pipelinedWriter struct {
+	failingWriter
+	imported  int      // The transitions imported by the replays.
+	committed []uint64 // The blocks committed by the writer itself, in the replays.
+	reverted  int      // The blocks reverted by the detached writers.
+}
+
+func (this *pipelinedWriter) Import(transitions []*univalue.Univalue) {
+	this.imported += len(transitions)
+}
+func (this *pipelinedWriter) Commit(blockNum uint64) error {
+	this.committed = append(this.committed, blockNum)
+	return nil
+}
+
+func (this *pipelinedWriter) Detach() stgcommon.Writer[*univalue.Univalue] {
+	return &detachedWriter{failingWriter: failingWriter{failing: this.failing}, parent: this}
+}
+
+type detachedWriter struct {
+	failingWriter
+	parent *pipelinedWriter
+}
+
+func (this *detachedWriter) RevertGeneration(uint64) { this.parent.reverted++ }
+
+func TestPipelineFailure(t *testing.T) {
+	journal, err := NewCommitJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &pipelinedWriter{failingWriter: failingWriter{failing: true}}
+	writers := []stgcommon.Writer[*univalue.Univalue]{writer}
+	committer := (&StateCommitter{writers: writers, asyncWriters: writers}).SetJournal(journal).EnablePipeline(2)
+
+	for blockNum := uint64(1); blockNum <= 2; blockNum++ {
+		committer.finalized = [][]*univalue.Univalue{{
+			univalue.NewUnivalue(1, "blcc://eth1.0/account/alice/storage/native/0", 0, 1, 0, noncommutative.NewInt64(int64(blockNum)), nil),
+		}}
+
+		if err := committer.SyncCommit(blockNum); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := committer.AsyncCommit(blockNum); err != nil { // Queued only, the failure comes later.
+			t.Fatal(err)
+		}
+	}
+
+	if err := committer.WaitCommitted(2); err == nil {
+		t.Fatal("Error: The failure of block 1 should have been reported")
+	}
+
+	if err := committer.DisablePipeline(); err == nil {
+		t.Error("Error: The failure should be returned when the pipeline is stopped")
+	}
+
+	// Block 1 failed and block 2 was skipped, both are taken off the staged batches.
+	if writer.reverted != 2 {
+		t.Error("Error: Both blocks should have been reverted", writer.reverted)
+	}
+
+	if _, ok := journal.LastBlock(); ok {
+		t.Error("Error: No block should have been committed")
+	}
+
+	// Both blocks are still in the journal and replayed in order.
+	if blockNum, err := committer.Recover(); err != nil || blockNum != 2 {
+		t.Fatal("Error: Failed to replay the blocks", blockNum, err)
+	}
+
+	if writer.imported != 2 || len(writer.committed) != 2 || writer.committed[0] != 1 || writer.committed[1] != 2 {
+		t.Error("Error: Wrong blocks replayed", writer.imported, writer.committed)
+	}
+}
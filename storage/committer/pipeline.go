@@ -0,0 +1,192 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// pipeline.go takes the asynchronous writers off the critical path. In the pipelined mode, AsyncCommit hands the
+// buffered block over to the detached copies of the writers and returns right away, so the next block can start
+// while the Ethereum tries and the live storage are still being written in the background. The blocks are committed
+// in order, the reads of the keys not written to the db yet are served from the staged batches of the writers.
+// With the journal enabled, the next block is recorded while the earlier ones are still being committed. Only
+// the Ethereum storage writer waits for the block in progress in its precommit, because the detached writer
+// shares the accounts and the world trie with it.
+//
+
+package statestore
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// A block to be committed by the detached writers.
+type commitJob struct {
+	blockNum uint64
+	writers  []stgcommon.Writer[*univalue.Univalue]
+	diff     *BlockDiff
+}
+
+type pipeline struct {
+	queue chan *commitJob
+	done  chan struct{}
+
+	lock         sync.Mutex
+	cond         *sync.Cond
+	queued       uint64 // The last block queued.
+	committed    uint64 // The last block committed by all the writers.
+	hasQueued    bool
+	hasCommitted bool
+	failed       error // The blocks after a failed one aren't committed to keep the writers in order.
+	failedBlock  uint64
+}
+
+// EnablePipeline starts committing the blocks with the asynchronous writers in the background. At most depth blocks
+// can be waiting, AsyncCommit blocks when the queue is full. It should be called between blocks.
+func (this *StateCommitter) EnablePipeline(depth int) *StateCommitter {
+	if this.pipeline != nil {
+		return this
+	}
+
+	this.pipeline = &pipeline{
+		queue: make(chan *commitJob, max(depth, 1)),
+		done:  make(chan struct{}),
+	}
+	this.pipeline.cond = sync.NewCond(&this.pipeline.lock)
+	go this.flush(this.pipeline)
+	return this
+}
+
+// DisablePipeline waits for all the queued blocks and switches back to committing in the caller's thread.
+// It returns the error of the first block failed, if any.
+func (this *StateCommitter) DisablePipeline() error {
+	if this.pipeline == nil {
+		return nil
+	}
+
+	close(this.pipeline.queue)
+	<-this.pipeline.done
+	err := this.pipeline.failed
+	this.pipeline = nil
+	return err
+}
+
+// WaitCommitted blocks until the block and all the blocks before it have been committed by all the writers.
+// It returns the error if any of them failed. In the pipelined mode, the errors of the asynchronous writers
+// are only reported here, not in the commit results.
+func (this *StateCommitter) WaitCommitted(blockNum uint64) error {
+	if this.pipeline == nil {
+		return nil // Committed in the caller's thread already.
+	}
+
+	p := this.pipeline
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for {
+		if p.hasCommitted && p.committed >= blockNum {
+			return nil
+		}
+
+		if p.failed != nil && p.failedBlock <= blockNum {
+			return p.failed
+		}
+
+		if !p.hasQueued || p.queued < blockNum {
+			return errors.New("Error: The block hasn't been committed")
+		}
+		p.cond.Wait()
+	}
+}
+
+// Commit the block with the writers can't be detached first, then hand the rest over to the background.
+func (this *StateCommitter) enqueue(blockNum uint64) error {
+	job := &commitJob{blockNum: blockNum}
+	inline := []stgcommon.Writer[*univalue.Univalue]{}
+	for _, writer := range this.asyncWriters {
+		if _, ok := writer.(stgcommon.PipelinedWriter[*univalue.Univalue]); !ok {
+			inline = append(inline, writer)
+		}
+	}
+
+	if err := this.run(PHASE_COMMIT, inline, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		return writer.Commit(blockNum)
+	}); err != nil {
+		return err
+	}
+
+	for _, writer := range this.asyncWriters {
+		if pipelined, ok := writer.(stgcommon.PipelinedWriter[*univalue.Univalue]); ok {
+			job.writers = append(job.writers, pipelined.Detach())
+		}
+	}
+	job.diff = this.takePending()
+
+	p := this.pipeline
+	p.lock.Lock()
+	p.queued, p.hasQueued = blockNum, true
+	p.lock.Unlock()
+
+	p.queue <- job // Wait if the queue is full.
+	return nil
+}
+
+// Commit the queued blocks in order. The journal and the subscribers are only updated when a block is fully committed.
+func (this *StateCommitter) flush(p *pipeline) {
+	for job := range p.queue {
+		p.lock.Lock()
+		err := p.failed
+		p.lock.Unlock()
+
+		if err == nil {
+			errs := make(CommitErrors, len(job.writers))
+			slice.ParallelForeach(job.writers, len(job.writers), func(i int, writer *stgcommon.Writer[*univalue.Univalue]) {
+				if err := (*writer).Commit(job.blockNum); err != nil {
+					errs[i] = &CommitError{Phase: PHASE_COMMIT, Writer: (*writer).Name(), Err: err}
+				}
+			})
+			slice.Remove(&errs, nil)
+			err = errs.Join()
+		}
+
+		if err == nil && this.journal != nil {
+			if err = this.journal.End(job.blockNum); err != nil {
+				err = &CommitError{Phase: PHASE_JOURNALING, Err: err}
+			}
+		}
+
+		if err == nil {
+			this.deliver(job.diff)
+		} else {
+			// Not in the db, stop serving the reads from the staged batches. The block is replayed from the journal.
+			for _, writer := range job.writers {
+				writer.RevertGeneration(0)
+			}
+		}
+
+		p.lock.Lock()
+		if err == nil {
+			p.committed, p.hasCommitted = job.blockNum, true
+		} else if p.failed == nil {
+			p.failed, p.failedBlock = err, job.blockNum
+		}
+		p.cond.Broadcast()
+		p.lock.Unlock()
+	}
+	close(p.done)
+}
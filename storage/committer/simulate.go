@@ -0,0 +1,83 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// simulate.go calculates the roots a candidate block would lead to without persisting anything, so the block
+// proposers can decide whether to seal it. The writers apply the pending transitions to copy-on-write views
+// of their states, neither the backend databases nor the live caches are touched.
+//
+
+package statestore
+
+import (
+	"maps"
+	"sync"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/storage/ethstorage"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// SimulationResult contains the roots the writers would have if the candidate block was committed.
+type SimulationResult struct {
+	EthRoot [32]byte            // The world trie root, empty if there is no Eth storage writer.
+	Roots   map[string][32]byte // The roots or checksums by the writer name, only for the writers supporting simulation.
+	Errors  CommitErrors        // The errors from the finalization and the simulation.
+}
+
+// Err returns all the errors combined, nil if the simulation is successful.
+func (this *SimulationResult) Err() error { return this.Errors.Join() }
+
+// Simulate finalizes the transitions of the whitelisted transactions and returns the roots on top of the
+// generations precommitted so far. The committer is left as it was before the finalization, neither the
+// merge counter, the timings nor the errors of the block change. The transitions imported are discarded
+// along with the finalized generation, they need to be imported again to be precommitted.
+func (this *StateCommitter) Simulate(txs []uint64) *SimulationResult {
+	merged, timings, errs := this.merged.Load(), maps.Clone(this.timings), this.errs
+	defer func() {
+		this.revert(this.generation) // Drop the finalized generation, including the cascading deletes.
+		this.merged.Store(merged)
+		this.timings, this.errs = timings, errs
+	}()
+
+	offset := len(this.errs)
+	this.Finalize(txs)
+
+	var lock sync.Mutex
+	result := &SimulationResult{Roots: map[string][32]byte{}}
+	this.run(PHASE_SIMULATE, this.writers, func(writer stgcommon.Writer[*univalue.Univalue]) error {
+		simulator, ok := writer.(stgcommon.WriterSimulator)
+		if !ok {
+			return nil
+		}
+
+		root, err := simulator.Simulate()
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := writer.(*ethstorage.EthStorageWriter); ok {
+			result.EthRoot = root
+		}
+		result.Roots[writer.Name()] = root
+		return err
+	})
+	result.Errors = append(CommitErrors{}, this.errs[offset:]...)
+	return result
+}
+
+// Discard drops the transitions imported or finalized but not precommitted yet. The generations
+// precommitted already are kept.
+func (this *StateCommitter) Discard() { this.revert(this.generation) }
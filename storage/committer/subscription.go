@@ -0,0 +1,246 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+//
+// subscription.go streams the finalized state changes of every committed block to the subscribers.
+// The diffs are only generated when there is at least one subscriber, otherwise there is no extra cost.
+//
+
+package statestore
+
+import (
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// StateDiff is the finalized change to a path in a block.
+type StateDiff struct {
+	Path string
+	Txs  []uint64 // The transactions that changed the path, by generation and then in ascending order.
+	Old  any      // The value before the block, nil if the path didn't exist.
+	New  any      // The value after the block, nil if the path has been deleted.
+}
+
+// BlockDiff contains all the changes in a block, sorted by path.
+type BlockDiff struct {
+	BlockNum uint64
+	Diffs    []*StateDiff
+}
+
+// DiffSubscription receives the diffs of the committed blocks in order. In the blocking mode, the committer
+// waits for the subscriber when the buffer is full. Otherwise the diffs are dropped and counted.
+type DiffSubscription struct {
+	ch       chan *BlockDiff
+	done     chan struct{}
+	blocking bool
+	dropped  atomic.Uint64
+	closed   sync.Once
+	lock     sync.Mutex // The channel is only closed when no diff is being sent.
+}
+
+// Diffs returns the channel to receive the block diffs from. It is closed when unsubscribed.
+func (this *DiffSubscription) Diffs() <-chan *BlockDiff { return this.ch }
+
+// Dropped returns the number of the block diffs dropped because the buffer was full.
+func (this *DiffSubscription) Dropped() uint64 { return this.dropped.Load() }
+
+func (this *DiffSubscription) send(diff *BlockDiff) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	select {
+	case <-this.done: // Unsubscribed already, the channel may have been closed.
+		return
+	default:
+	}
+
+	if this.blocking {
+		select {
+		case this.ch <- diff:
+		case <-this.done: // Unsubscribed while waiting.
+		}
+		return
+	}
+
+	select {
+	case this.ch <- diff:
+	default:
+		this.dropped.Add(1)
+	}
+}
+
+// The subscribers and the diffs of the current block.
+type subscribers struct {
+	lock    sync.Mutex
+	subs    []*DiffSubscription
+	diffs   [][]*StateDiff // The diffs of each generation in the current block.
+	pending *BlockDiff     // The diffs of the block being committed by the asynchronous writers.
+}
+
+// Subscribe starts receiving the diffs of the blocks committed from now on. The buffer size is the number of
+// the blocks that can be buffered.
+func (this *StateCommitter) Subscribe(bufferSize int, blocking bool) *DiffSubscription {
+	sub := &DiffSubscription{
+		ch:       make(chan *BlockDiff, bufferSize),
+		done:     make(chan struct{}),
+		blocking: blocking,
+	}
+
+	this.subscribers.lock.Lock()
+	defer this.subscribers.lock.Unlock()
+	this.subscribers.subs = append(this.subscribers.subs, sub)
+	return sub
+}
+
+// Unsubscribe stops the delivery and closes the channel of the subscription. It can be called more than once.
+func (this *StateCommitter) Unsubscribe(sub *DiffSubscription) {
+	sub.closed.Do(func() {
+		close(sub.done) // Release the committer if it is waiting on the subscriber.
+
+		this.subscribers.lock.Lock()
+		slice.Remove(&this.subscribers.subs, sub)
+		this.subscribers.lock.Unlock()
+
+		sub.lock.Lock()
+		defer sub.lock.Unlock()
+		close(sub.ch)
+	})
+}
+
+func (this *StateCommitter) subscribed() bool {
+	this.subscribers.lock.Lock()
+	defer this.subscribers.lock.Unlock()
+	return len(this.subscribers.subs) > 0
+}
+
+// Generate the diffs of the generation from the finalized transitions in the path indexer and the cascade deletes.
+// The old values are still in the store because the generation hasn't been precommitted yet.
+func (this *StateCommitter) diff(cascades []*univalue.Univalue) []*StateDiff {
+	newDiff := func(v *univalue.Univalue, txs []uint64) *StateDiff {
+		if v.GetPath() == nil || v.IsBlockBound() {
+			return nil
+		}
+
+		diff := &StateDiff{Path: *v.GetPath(), Txs: txs}
+		old, _ := this.readonlyStore.Retrive(diff.Path, v.Value())
+		diff.Old = deepCopy(old)
+		if v.Value() != nil {
+			diff.New = deepCopy(v.Value().(stgcommon.Type).Clone()) // The value may be updated by the later blocks.
+		}
+		return diff
+	}
+
+	diffs := slice.ParallelTransform(this.byPath.Values(), runtime.NumCPU(), func(_ int, vals []*univalue.Univalue) *StateDiff {
+		if len(vals) == 0 {
+			return nil
+		}
+
+		txs := slice.Transform(vals, func(_ int, v *univalue.Univalue) uint64 { return v.GetTx() })
+		sort.Slice(txs, func(i, j int) bool { return txs[i] < txs[j] })
+		return newDiff(vals[0], txs)
+	})
+
+	for _, v := range cascades {
+		diffs = append(diffs, newDiff(v, []uint64{v.GetTx()}))
+	}
+	slice.Remove(&diffs, nil)
+	return diffs
+}
+
+// The clones of the containers share the committed keys with the store, they are copied into standalone ones.
+func deepCopy(v any) any {
+	path, ok := v.(*commutative.Path)
+	if !ok || path == nil {
+		return v
+	}
+
+	copied := commutative.NewPath().(*commutative.Path)
+	copied.SetSubPaths(slices.Clone(path.View().Elements()))
+	copied.ElemType, copied.Expression, copied.IsSysPath = path.ElemType, path.Expression, path.IsSysPath
+	copied.Ordering, copied.TotalSize = path.Ordering, path.TotalSize
+	copied.SetBlockBound(path.IsBlockBound())
+	return copied
+}
+
+// Merge the diffs of all the generations into the block diff. For a path changed in multiple
+// generations, the old value is from the first one and the new value is from the last one.
+func (this *StateCommitter) blockDiff(blockNum uint64) *BlockDiff {
+	positions := map[string]int{}
+	merged := []*StateDiff{}
+	for _, generation := range this.subscribers.diffs {
+		for _, diff := range generation {
+			if idx, ok := positions[diff.Path]; ok {
+				merged[idx].New = diff.New
+				merged[idx].Txs = append(merged[idx].Txs, diff.Txs...)
+				continue
+			}
+			positions[diff.Path] = len(merged)
+			merged = append(merged, diff)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Path < merged[j].Path })
+	return &BlockDiff{BlockNum: blockNum, Diffs: merged}
+}
+
+// Hold the diffs of the block until the asynchronous writers are done too. A block retried after a failed
+// asynchronous commit has no finalized transitions left, so the diffs from the first attempt are kept.
+func (this *StateCommitter) hold(diff *BlockDiff) {
+	this.subscribers.lock.Lock()
+	defer this.subscribers.lock.Unlock()
+
+	if pending := this.subscribers.pending; pending != nil && pending.BlockNum == diff.BlockNum && len(diff.Diffs) == 0 {
+		return
+	}
+	this.subscribers.pending = diff
+}
+
+// Deliver the diffs of the committed block to all the subscribers in order.
+func (this *StateCommitter) publish() { this.deliver(this.takePending()) }
+
+// Take over the diffs of the block being committed.
+func (this *StateCommitter) takePending() *BlockDiff {
+	this.subscribers.lock.Lock()
+	defer this.subscribers.lock.Unlock()
+
+	diff := this.subscribers.pending
+	this.subscribers.pending = nil
+	return diff
+}
+
+func (this *StateCommitter) deliver(diff *BlockDiff) {
+	if diff == nil {
+		return
+	}
+
+	// Not sending under the lock, so a slow subscriber doesn't hold up the others subscribing or unsubscribing.
+	this.subscribers.lock.Lock()
+	subs := slices.Clone(this.subscribers.subs)
+	this.subscribers.lock.Unlock()
+
+	for _, sub := range subs {
+		sub.send(diff)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+func TestDiffSubscription(t *testing.T) {
+	committer := &StateCommitter{}
+	blocking := committer.Subscribe(2, true)
+	dropping := committer.Subscribe(1, false)
+
+	for blockNum := uint64(1); blockNum <= 2; blockNum++ {
+		committer.subscribers.diffs = [][]*StateDiff{
+			{{Path: "alice", Txs: []uint64{1}, Old: nil, New: 1}, {Path: "bob", Txs: []uint64{2}, Old: 2, New: nil}},
+			{{Path: "alice", Txs: []uint64{3}, Old: 1, New: 3}},
+		}
+		committer.subscribers.pending = committer.blockDiff(blockNum)
+		committer.publish()
+	}
+
+	diff := <-blocking.Diffs()
+	if diff.BlockNum != 1 || len(diff.Diffs) != 2 {
+		t.Fatal("Error: Wrong block diff", diff.BlockNum, len(diff.Diffs))
+	}
+
+	// The old value is from the first generation and the new value is from the last one.
+	if alice := diff.Diffs[0]; alice.Old != nil || alice.New != 3 || !reflect.DeepEqual(alice.Txs, []uint64{1, 3}) {
+		t.Error("Error: Wrong diff", alice)
+	}
+
+	if diff = <-blocking.Diffs(); diff.BlockNum != 2 {
+		t.Error("Error: Wrong block order", diff.BlockNum)
+	}
+
+	if dropping.Dropped() != 1 {
+		t.Error("Error: The second block should have been dropped", dropping.Dropped())
+	}
+
+	committer.Unsubscribe(dropping)
+	if _, ok := <-dropping.Diffs(); !ok {
+		t.Error("Error: The buffered diff should still be readable")
+	}
+
+	if _, ok := <-dropping.Diffs(); ok {
+		t.Error("Error: The channel should have been closed")
+	}
+}
+
+func TestDiffSubscriptionRetry(t *testing.T) {
+	writer := &failingWriter{failing: true}
+	committer := &StateCommitter{asyncWriters: []stgcommon.Writer[*univalue.Univalue]{writer}}
+	sub := committer.Subscribe(2, false)
+
+	committer.subscribers.diffs = [][]*StateDiff{{{Path: "alice", Txs: []uint64{1}, Old: nil, New: 1}}}
+	if err := committer.SyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := committer.AsyncCommit(5); err == nil {
+		t.Fatal("Error: The asynchronous commit should have failed")
+	}
+
+	if len(sub.Diffs()) != 0 {
+		t.Fatal("Error: Nothing should be delivered before the block is committed")
+	}
+
+	// The retry has no diffs left, the ones from the first attempt are delivered.
+	writer.failing = false
+	if err := committer.SyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := committer.AsyncCommit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := <-sub.Diffs(); diff.BlockNum != 5 || len(diff.Diffs) != 1 || diff.Diffs[0].Path != "alice" {
+		t.Error("Error: Wrong block diff", diff.BlockNum, len(diff.Diffs))
+	}
+
+	committer.Unsubscribe(sub)
+	committer.Unsubscribe(sub) // Unsubscribing twice is fine.
+	if _, ok := <-sub.Diffs(); ok {
+		t.Error("Error: The channel should have been closed")
+	}
+}
+
+func TestDiffSubscriptionSlow(t *testing.T) {
+	committer := &StateCommitter{}
+	slow := committer.Subscribe(0, true) // Never reads.
+
+	delivered := make(chan struct{})
+	go func() {
+		committer.deliver(&BlockDiff{BlockNum: 1})
+		close(delivered)
+	}()
+	time.Sleep(10 * time.Millisecond) // Let the delivery wait on the slow subscriber.
+
+	// The others can still subscribe and unsubscribe.
+	done := make(chan struct{})
+	go func() {
+		committer.Unsubscribe(committer.Subscribe(1, false))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Error: Blocked by the slow subscriber")
+	}
+
+	committer.Unsubscribe(slow) // Releases the delivery.
+	<-delivered
+	if _, ok := <-slow.Diffs(); ok {
+		t.Error("Error: Nothing should have been delivered")
+	}
+}
+
+func TestDiffDeepCopy(t *testing.T) {
+	path := commutative.NewPath().(*commutative.Path)
+	path.SetSubPaths([]string{"a"})
+
+	copied := deepCopy(path.Clone()).(*commutative.Path)
+	path.SetSubPaths([]string{"b"}) // The committed keys are shared by the clone.
+	if keys := copied.View().Elements(); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Error("Error: The copy shouldn't change with the store", keys)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package statestore
+
+import (
+	"strings"
+
+	"github.com/arcology-network/common-lib/common"
+	"github.com/arcology-network/storage-committer/type/commutative"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
+
+// IsWildcard checks if the transition is a wildcard delete exported by WriteCache.WildcardsToUnivalue().
+func IsWildcard(v *univalue.Univalue) bool {
+	return v.GetPath() != nil && v.Value() == nil && !v.IsReadOnly() && // Not a range read.
+		(strings.HasSuffix(*v.GetPath(), "*") || strings.HasSuffix(*v.GetPath(), "[:]"))
+}
+
+// ExpandWildcards replaces the wildcard deletes with the concrete delete transitions of all the committed
+// keys matching them, so the writers don't need to know about the wildcards. The expanded transitions are
+// flagged with SetExpanded(true). A wildcard can be either a path with all its descendants or a key prefix.
+func (this *StateCommitter) ExpandWildcards(transitions []*univalue.Univalue) []*univalue.Univalue {
+	expanded := make([]*univalue.Univalue, 0, len(transitions))
+	for _, v := range transitions {
+		if v == nil || !IsWildcard(v) {
+			expanded = append(expanded, v)
+			continue
+		}
+
+		prefix, _ := common.TrimWildcardSuffix(*v.GetPath())
+		parent := prefix[:strings.LastIndex(prefix, "/")+1] // The prefix itself if it is a path.
+		for _, key := range this.committedSubs(parent) {
+			if !strings.HasPrefix(key, prefix) || key == prefix {
+				continue
+			}
+
+			sub := univalue.NewUnivalue(v.GetTx(), key, 0, 1, 0, nil, nil)
+			sub.SetExpanded(true)
+			sub.SetBlockBound(v.IsBlockBound())
+			sub.SkipConflictCheck(v.IfSkipConflictCheck())
+			expanded = append(expanded, sub)
+		}
+	}
+	return expanded
+}
+
+// Get all the committed descendants of the path, nil if the path doesn't exist.
+func (this *StateCommitter) committedSubs(path string) []string {
+	committed, _ := this.readonlyStore.Retrive(path, new(commutative.Path))
+	if committed == nil {
+		return nil
+	}
+	return committed.(*commutative.Path).GetCascadeSub(path, this.readonlyStore)
+}
@@ -235,6 +235,16 @@ func (this *Account) Retrive(key string, T any) (interface{}, error) {
 }
 
 func (this *Account) UpdateAccountTrie(keys []string, typedVals []stgcommon.Type) error {
+	return this.updateAccountTrie(keys, typedVals, true)
+}
+
+// SimulateAccountTrie updates the account the same way as UpdateAccountTrie but doesn't save the code to the DB.
+// It is meant to be called on a copy of the account to calculate the roots.
+func (this *Account) SimulateAccountTrie(keys []string, typedVals []stgcommon.Type) error {
+	return this.updateAccountTrie(keys, typedVals, false)
+}
+
+func (this *Account) updateAccountTrie(keys []string, typedVals []stgcommon.Type, saveCode bool) error {
 	if pos, _ := slice.FindFirstIf(keys, func(_ int, k string) bool { return len(k) == stgcommon.ETH10_ACCOUNT_FULL_LENGTH+1 }); pos >= 0 {
 		slice.RemoveAt(&keys, pos)
 		slice.RemoveAt(&typedVals, pos)
@@ -256,8 +266,10 @@ func (this *Account) UpdateAccountTrie(keys []string, typedVals []stgcommon.Type
 	if pos, _ := slice.FindFirstIf(keys, func(_ int, k string) bool { return strings.HasSuffix(k, "/code") }); pos >= 0 {
 		this.code = typedVals[pos].Value().(codec.Bytes)
 		this.StateAccount.CodeHash = this.Hash(this.code)
-		if err := this.DB(keys[pos]).Put(this.CodeHash, this.code); err != nil { // Save to DB directly, only for code
-			return err // failed to save the code
+		if saveCode {
+			if err := this.DB(keys[pos]).Put(this.CodeHash, this.code); err != nil { // Save to DB directly, only for code
+				return err // failed to save the code
+			}
 		}
 		slice.RemoveAt(&keys, pos)
 		slice.RemoveAt(&typedVals, pos)
@@ -315,14 +327,28 @@ func (*Account) Decode(buffer []byte) *Account {
 	return &Account{StateAccount: acctState}
 }
 
-// Write the DB
+// Write the DB. The storage trie and the dirty flag are only updated on success, so a failed commit can be retried.
 func (this *Account) Commit(block uint64) error {
-	var err error
-	if this.StorageDirty {
-		this.storageTrie, err = commitToEthDB(this.storageTrie, this.ethdb, block) // Commit the change to the storage trie.
-		this.StorageDirty = false
+	if !this.StorageDirty {
+		return nil
+	}
+
+	trie, err := commitToEthDB(this.storageTrie, this.ethdb, block) // Commit the change to the storage trie.
+	if err != nil {
+		return err
+	}
+	this.storageTrie, this.StorageDirty = trie, false
+	return nil
+}
+
+// Copy makes a copy of the account, so the changes to the account can be undone later.
+// The storage trie is copied but the underlying databases are shared.
+func (this *Account) Copy() *Account {
+	copied := *this
+	if this.storageTrie != nil {
+		copied.storageTrie = this.storageTrie.Copy()
 	}
-	return err // Write to DB
+	return &copied
 }
 
 func (this *Account) Hash(key []byte) []byte {
@@ -0,0 +1,63 @@
+/*
+ *   Copyright (c) 2024 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ethstorage
+
+import (
+	"github.com/arcology-network/common-lib/exp/associative"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethmpt "github.com/ethereum/go-ethereum/trie"
+)
+
+// EthSnapshot keeps the world trie and the accounts to be updated by a generation, so the
+// EthDataStore can be restored if the generation is reverted before the block is committed.
+type EthSnapshot struct {
+	worldStateTrie *ethmpt.Trie
+	accounts       []*associative.Pair[*Account, *Account] // The cached accounts and their copies.
+	uncached       []ethcommon.Address                     // The accounts that weren't in the account cache.
+}
+
+// Snapshot takes a snapshot of the world trie and the accounts about to be updated.
+func (this *EthDataStore) Snapshot(dirtyAccounts []*Account) *EthSnapshot {
+	snapshot := &EthSnapshot{
+		worldStateTrie: this.worldStateTrie.Copy(),
+		accounts:       make([]*associative.Pair[*Account, *Account], 0, len(dirtyAccounts)),
+		uncached:       []ethcommon.Address{},
+	}
+
+	for _, acct := range dirtyAccounts {
+		if cached := this.accountCache[acct.addr]; cached == acct {
+			snapshot.accounts = append(snapshot.accounts, &associative.Pair[*Account, *Account]{First: acct, Second: acct.Copy()})
+		} else {
+			snapshot.uncached = append(snapshot.uncached, acct.addr)
+		}
+	}
+	return snapshot
+}
+
+// Revert restores the world trie and the accounts to the snapshot. The accounts are restored in place
+// because the indexers of the earlier generations still hold the references to them.
+func (this *EthDataStore) Revert(snapshot *EthSnapshot) {
+	this.worldStateTrie = snapshot.worldStateTrie
+	for _, pair := range snapshot.accounts {
+		*pair.First = *pair.Second
+	}
+
+	for _, addr := range snapshot.uncached {
+		delete(this.accountCache, addr)
+	}
+}
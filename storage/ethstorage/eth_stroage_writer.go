@@ -23,15 +23,17 @@ import (
 
 	"github.com/arcology-network/common-lib/exp/associative"
 	"github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
 	"github.com/arcology-network/storage-committer/type/univalue"
 )
 
 type EthStorageWriter struct {
 	*EthIndexer
 	buffer   []*EthIndexer
+	journal  []*EthSnapshot // The states before each of the generations, for reverting.
 	ethStore *EthDataStore
 	filter   func(*univalue.Univalue) bool // Filter function to select transitions to be indexed
-	Err      error
+	written  uint64                        // The number of transitions written in the last block.
 }
 
 func NewEthStorageWriter(ethStore *EthDataStore, version int64, filter func(*univalue.Univalue) bool) *EthStorageWriter {
@@ -39,16 +41,24 @@ func NewEthStorageWriter(ethStore *EthDataStore, version int64, filter func(*uni
 		EthIndexer: NewEthIndexer(ethStore, version, filter),
 		ethStore:   ethStore,
 		buffer:     []*EthIndexer{},
+		journal:    []*EthSnapshot{},
 		filter:     filter,
 	}
 }
 
-func (this *EthStorageWriter) Precommit(isSync bool) {
+// Precommit updates the account tries and the world trie with the transitions of the generation.
+// The world trie is still updated if some of the accounts failed, the errors are all returned.
+// It waits for the block being committed by a detached writer, if any, because they share the same accounts and the world trie.
+func (this *EthStorageWriter) Precommit(isSync bool) error {
+	this.ethStore.lock.Lock()
+	defer this.ethStore.lock.Unlock()
+
 	this.EthIndexer.Finalize() // Remove the nil transitions
 	this.buffer = append(this.buffer, this.EthIndexer)
 
 	pairs := this.EthIndexer.UnorderedIndexer.Values()                                                  // Export all the pairs to be written to the db
 	this.EthIndexer.dirtyAccounts = (associative.Pairs[*Account, []*univalue.Univalue])(pairs).Firsts() // Get the accounts.
+	this.journal = append(this.journal, this.ethStore.Snapshot(this.EthIndexer.dirtyAccounts))          // Before any changes are made.
 
 	// Account cache holds the accounts that are being updated in the current block.
 	// TODO: Need to check if this is necessary or could be moved to the import phase instead.
@@ -56,29 +66,93 @@ func (this *EthStorageWriter) Precommit(isSync bool) {
 		this.ethStore.accountCache[(**pair).Address()] = (*pair) // Add the account to the cache
 	})
 
+	errs := make([]error, len(pairs))
 	slice.ParallelForeach(pairs, runtime.NumCPU(), func(i int, acctTrans **associative.Pair[*Account, []*univalue.Univalue]) {
 		if len((*acctTrans).Second) == 0 {
 			return // All removed
 		}
 
-		keys, vals := univalue.Univalues((*acctTrans).Second).KVs()           // Get all transitions under the same account
-		err := this.EthIndexer.dirtyAccounts[i].UpdateAccountTrie(keys, vals) //
-		if err != nil {
-			this.ethStore.dbErr = errors.Join(this.ethStore.dbErr, err)
-		}
+		keys, vals := univalue.Univalues((*acctTrans).Second).KVs() // Get all transitions under the same account
+		errs[i] = this.EthIndexer.dirtyAccounts[i].UpdateAccountTrie(keys, vals)
 	})
 
-	this.ethStore.WriteWorldTrie(this.EthIndexer.dirtyAccounts)     // Update the world trie
-	this.EthIndexer = NewEthIndexer(this.ethStore, -1, this.filter) // Reset the indexer with a default version number.
+	_, err := this.ethStore.WriteWorldTrie(this.EthIndexer.dirtyAccounts) // Update the world trie
+	this.EthIndexer = NewEthIndexer(this.ethStore, -1, this.filter)       // Reset the indexer with a default version number.
 	this.EthIndexer.UnorderedIndexer.Clear()
+	return errors.Join(append(errs, err)...)
 }
 
-// Signals a block is completed, time to write to the db.
-func (this *EthStorageWriter) Commit(version uint64) {
+// Signals a block is completed, time to write to the db. The buffered generations are kept if it fails.
+// The stats are reset first, nothing is reported as written if it fails.
+func (this *EthStorageWriter) Commit(version uint64) error {
+	this.written = 0
 	mergedIdxer := new(EthIndexer).Merge(this.buffer[:]) // Merge all the indexers together to commit to the db at once.
-	this.ethStore.WriteToEthStorage(uint64(mergedIdxer.Version), mergedIdxer.dirtyAccounts)
+	if err := this.ethStore.WriteToEthStorage(uint64(mergedIdxer.Version), mergedIdxer.dirtyAccounts); err != nil {
+		return err
+	}
+
+	for _, idxer := range this.buffer {
+		for _, pair := range idxer.UnorderedIndexer.Values() {
+			this.written += uint64(len(pair.Second))
+		}
+	}
 	this.buffer = this.buffer[:0]
+	this.journal = this.journal[:0]
+	return nil
+}
+
+// RevertGeneration restores the world trie and the accounts to the states before the generation.
+// The buffered indexers of the generation and all the generations after it are dropped.
+func (this *EthStorageWriter) RevertGeneration(gen uint64) {
+	this.ethStore.lock.Lock()
+	defer this.ethStore.lock.Unlock()
+
+	for len(this.journal) > int(gen) {
+		this.ethStore.Revert(this.journal[len(this.journal)-1])
+		this.journal = this.journal[:len(this.journal)-1]
+	}
+	this.buffer = this.buffer[:min(int(gen), len(this.buffer))]
+	this.EthIndexer = NewEthIndexer(this.ethStore, -1, this.filter) // Discard the pending transitions.
+}
+
+// Simulate returns the world trie root with the pending transitions applied on top of the precommitted generations.
+// The transitions are applied to the copies of the accounts and the world trie, so nothing is changed.
+func (this *EthStorageWriter) Simulate() ([32]byte, error) {
+	this.ethStore.lock.Lock()
+	defer this.ethStore.lock.Unlock()
+
+	this.EthIndexer.Finalize() // Remove the nil transitions
+
+	pairs := this.EthIndexer.UnorderedIndexer.Values()
+	accounts := make([]*Account, len(pairs))
+	errs := make([]error, len(pairs))
+	slice.ParallelForeach(pairs, runtime.NumCPU(), func(i int, acctTrans **associative.Pair[*Account, []*univalue.Univalue]) {
+		accounts[i] = (*acctTrans).First.Copy()
+		if len((*acctTrans).Second) == 0 {
+			return // All removed
+		}
+
+		keys, vals := univalue.Univalues((*acctTrans).Second).KVs()
+		errs[i] = accounts[i].SimulateAccountTrie(keys, vals)
+	})
+
+	root, err := this.ethStore.SimulateWorldTrie(accounts)
+	return root, errors.Join(append(errs, err)...)
+}
+
+// Detach hands the buffered generations over to a new writer to commit in the background.
+// The generations can no longer be reverted after that.
+func (this *EthStorageWriter) Detach() stgcommon.Writer[*univalue.Univalue] {
+	this.written = 0 // The stats of the block are with the detached writer.
+	detached := NewEthStorageWriter(this.ethStore, -1, this.filter)
+	detached.buffer = this.buffer
+
+	this.buffer = []*EthIndexer{}
+	this.journal = this.journal[:0]
+	return detached
 }
 
-func (this *EthStorageWriter) IsSync() bool { return false }
-func (this *EthStorageWriter) Name() string { return "Eth Storage Writer" }
+func (this *EthStorageWriter) Root() [32]byte            { return this.ethStore.Root() } // The latest world trie root.
+func (this *EthStorageWriter) Written() (uint64, uint64) { return this.written, 0 }      // The tries are encoded by the db.
+func (this *EthStorageWriter) IsSync() bool              { return false }
+func (this *EthStorageWriter) Name() string              { return "Eth Storage Writer" }
@@ -60,8 +60,6 @@ type EthDataStore struct {
 	encoder func(string, any) []byte
 	decoder func(string, []byte, any) any
 
-	dbErr error
-
 	trieDbConfig *hashdb.Config   // The config for the hash db underlying the trie.
 	encodedCache *fastcache.Cache // A shared cache holding the encoded account states to be used by different instances of the Eth Database
 }
@@ -130,9 +128,13 @@ func NewLevelDBDataStore(dir string) *EthDataStore {
 
 // Preload loads an existing account from the trie and the disk db.
 // If the account is not found, it creates a new account with default account state and shared cache.
+// It waits for the world trie being committed to the db, if any.
 func (this *EthDataStore) Preload(addr []byte) any {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
 	// AccessListCache doesn't serve any purpose for now. It is only a place holder, the parallelized trie update requires its presence.
-	acct, _ := this.GetAccount(ethcommon.BytesToAddress(addr), common.Reference(ethmpt.AccessListCache{}))
+	acct, _ := this.getAccount(ethcommon.BytesToAddress(addr), common.Reference(ethmpt.AccessListCache{}))
 	if acct == nil {
 		acct = NewAccountWithSharedCache( // Account not found, create a new account
 			ethcommon.BytesToAddress(addr),
@@ -158,7 +160,11 @@ func (this *EthDataStore) Hash(key string) []byte {
 	return sum
 }
 
+// GetAccountProof returns the proof of the account in the world trie. It waits for the world trie being committed to the db, if any.
 func (this *EthDataStore) GetAccountProof(addr ethcommon.Address) ([]string, error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
 	addrHash := crypto.Keccak256(addr.Bytes())
 
 	var proof proofList
@@ -172,6 +178,9 @@ func (this *EthDataStore) GetAccountProof(addr ethcommon.Address) ([]string, err
 
 // Get the account from the cache first, if not found, get it from the trie.
 func (this *EthDataStore) IfExists(key string) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
 	accesses := ethmpt.AccessListCache{}
 	_, acctKey, suffix := platform.ParseAccountAddr(key)
 	if len(suffix) == 0 {
@@ -213,17 +222,30 @@ func (this *EthDataStore) IfExists(key string) bool {
 
 // Get the account from the cache first, if not found, get it from the trie.
 func (this *EthDataStore) GetAccount(address ethcommon.Address, accesses *ethmpt.AccessListCache) (*Account, error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.getAccount(address, accesses)
+}
+
+// The callers must hold the lock.
+func (this *EthDataStore) getAccount(address ethcommon.Address, accesses *ethmpt.AccessListCache) (*Account, error) {
 	if len(address) > 0 {
 		if v := this.accountCache[address]; v != nil { // Lookup in the cache first
 			return v, nil
 		}
-		return this.GetAccountFromTrie(address, accesses)
+		return this.getAccountFromTrie(address, accesses)
 	}
 	return nil, errors.New("Invalid account: " + address.String())
 }
 
 // Get the account from the trie
 func (this *EthDataStore) GetAccountFromTrie(address ethcommon.Address, accesses *ethmpt.AccessListCache) (*Account, error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.getAccountFromTrie(address, accesses)
+}
+
+func (this *EthDataStore) getAccountFromTrie(address ethcommon.Address, accesses *ethmpt.AccessListCache) (*Account, error) {
 	acctHash := crypto.Keccak256(address.Bytes()) // Hash the key string
 	buffer, err := this.worldStateTrie.Get(acctHash)
 	if err == nil && len(buffer) > 0 { // Not found
@@ -248,8 +270,11 @@ func (this *EthDataStore) GetAccountFromTrie(address ethcommon.Address, accesses
 	return nil, err
 }
 
-// Skip the cache and get from the trie
+// Skip the cache and get from the trie. It waits for the world trie being committed to the db, if any.
 func (this *EthDataStore) Retrive(key string, T any) (any, error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
 	accesses := ethmpt.AccessListCache{}
 	_, acctKey, _ := platform.ParseAccountAddr(key) // Get the address
 	if len(acctKey) == 0 {
@@ -263,7 +288,7 @@ func (this *EthDataStore) Retrive(key string, T any) (any, error) {
 
 	// Get the account the key belongs to.
 	address := ethcommon.BytesToAddress(acctBytes)
-	account, err := this.GetAccount(address, &accesses)
+	account, err := this.getAccount(address, &accesses)
 
 	if account != nil {
 		return account.Retrive(key, T) // Get the storage from the key
@@ -271,8 +296,19 @@ func (this *EthDataStore) Retrive(key string, T any) (any, error) {
 	return nil, err
 }
 
-// The WriteWorldTrie writes the updated accounts to the world trie.
-func (this *EthDataStore) WriteWorldTrie(dirtyAccounts []*Account) [32]byte {
+// The WriteWorldTrie writes the updated accounts to the world trie. It returns the new root and the errors
+// encountered while updating the trie, if any.
+func (this *EthDataStore) WriteWorldTrie(dirtyAccounts []*Account) ([32]byte, error) {
+	return updateWorldTrie(this.worldStateTrie, dirtyAccounts)
+}
+
+// SimulateWorldTrie returns the root the world trie would have after the accounts are written to it.
+// The accounts are written to a copy of the trie, the world trie itself is left unchanged.
+func (this *EthDataStore) SimulateWorldTrie(dirtyAccounts []*Account) ([32]byte, error) {
+	return updateWorldTrie(this.worldStateTrie.Copy(), dirtyAccounts)
+}
+
+func updateWorldTrie(trie *ethmpt.Trie, dirtyAccounts []*Account) ([32]byte, error) {
 	encodedAddrs, encodedAcct := [][]byte{}, [][]byte{} // Encode the account key and values
 	common.ParallelExecute(
 		func() { // Account keys
@@ -287,10 +323,9 @@ func (this *EthDataStore) WriteWorldTrie(dirtyAccounts []*Account) [32]byte {
 		},
 	)
 
-	// Write the world tree and return the first error if any.
-	errs := this.worldStateTrie.ParallelUpdate(encodedAddrs, encodedAcct)
-	this.dbErr = errors.Join(this.dbErr, errors.Join(errs...))
-	return this.worldStateTrie.Hash()
+	// Write the world tree and return the errors if any.
+	errs := trie.ParallelUpdate(encodedAddrs, encodedAcct)
+	return trie.Hash(), errors.Join(errs...)
 }
 
 // Calculate the root hash for the world trie
@@ -298,7 +333,11 @@ func (this *EthDataStore) LatestWorldTrieRoot() [32]byte {
 	return this.worldStateTrie.Hash() // Store the root hash for the block
 }
 
-func (this *EthDataStore) WriteToEthStorage(blockNum uint64, dirtyAccounts []*Account) {
+// WriteToEthStorage commits the storage tries of the dirty accounts and then the world trie to the database.
+// The world trie isn't committed if any of the accounts fails. The write lock is held throughout, including
+// while the accounts are committed, so nothing called from here may call back into the readers of the store,
+// they take the read lock and the lock isn't reentrant.
+func (this *EthDataStore) WriteToEthStorage(blockNum uint64, dirtyAccounts []*Account) error {
 	this.lock.Lock()
 	defer this.lock.Unlock()
 
@@ -322,20 +361,26 @@ func (this *EthDataStore) WriteToEthStorage(blockNum uint64, dirtyAccounts []*Ac
 	}
 	_, uniqueDirties := mapi.KVs(dict)
 
-	// Write the world trie
-	slice.ParallelForeach(uniqueDirties, runtime.NumCPU(), func(_ int, dirties *[]*Account) {
+	// Write the storage tries
+	errs := make([]error, len(uniqueDirties))
+	slice.ParallelForeach(uniqueDirties, runtime.NumCPU(), func(i int, dirties *[]*Account) {
 		for _, acct := range *dirties { // There may be multiple updates for the same account.
 			if err := (acct).Commit(blockNum); err != nil {
-				panic(err)
+				errs[i] = errors.Join(errs[i], err)
 			}
 		}
 	})
 
-	var err error
-	this.worldStateTrie, err = parallelcommitToEthDB(this.worldStateTrie, this.ethdb, blockNum) // Reload the trie for the next block
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	trie, err := parallelcommitToEthDB(this.worldStateTrie, this.ethdb, blockNum) // Reload the trie for the next block
 	if err != nil {
-		this.dbErr = errors.Join(this.dbErr, err)
+		return err
 	}
+	this.worldStateTrie = trie
+	return nil
 }
 
 func (this *EthDataStore) BatchRetrive(keys []string, T []any) []any {
@@ -351,7 +396,6 @@ func (this *EthDataStore) DiskDBs() [16]ethdb.Database {
 }
 
 // Place holders
-func (this *EthDataStore) Root() [32]byte                            { return this.worldStateTrie.Hash() }
 func (this *EthDataStore) Encoder(any) func(string, any) []byte      { return this.encoder }
 func (this *EthDataStore) Decoder(any) func(string, []byte, any) any { return this.decoder }
 func (this *EthDataStore) EthDB() *triedb.Database                   { return this.ethdb }
@@ -370,6 +414,13 @@ func (this *EthDataStore) Clear()                                      {}
 
 func (this *EthDataStore) Inject(key string, value any) error { return nil }
 
+// Root returns the latest world trie root. It waits for the world trie being committed to the db, if any.
+func (this *EthDataStore) Root() [32]byte {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.worldStateTrie.Hash()
+}
+
 func (this *EthDataStore) GetRootHash(blockNum uint64) [32]byte {
 	this.lock.RLock()
 	defer this.lock.RUnlock()
@@ -18,10 +18,16 @@
 package ethstorage
 
 import (
+	"errors"
 	"testing"
 
+	slice "github.com/arcology-network/common-lib/exp/slice"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/noncommutative"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/holiman/uint256"
 )
@@ -56,3 +62,61 @@ func TestAccountCode(t *testing.T) {
 		t.Error("Error: Blance mismatched!!")
 	}
 }
+
+// A db that fails to write the batches while failing is set.
+type failingDB struct {
+	ethdb.Database
+	failing bool
+}
+
+type failingBatch struct {
+	ethdb.Batch
+	db *failingDB
+}
+
+func (this *failingDB) NewBatch() ethdb.Batch { return &failingBatch{this.Database.NewBatch(), this} }
+func (this *failingDB) NewBatchWithSize(size int) ethdb.Batch {
+	return &failingBatch{this.Database.NewBatchWithSize(size), this}
+}
+
+func (this *failingBatch) Write() error {
+	if this.db.failing {
+		return errors.New("Error: Failed to write the batch")
+	}
+	return this.Batch.Write()
+}
+
+func TestAccountCommitRetry(t *testing.T) {
+	db := &failingDB{Database: rawdb.NewMemoryDatabase(), failing: true}
+	diskdbs := [16]ethdb.Database{}
+	slice.Fill(diskdbs[:], ethdb.Database(db))
+
+	acct := NewAccount(ethcommon.BytesToAddress([]byte("3456")), diskdbs, EmptyAccountState())
+	key := "blcc://eth1.0/account/0x0000000000000000000000000000000000003456/storage/native/0x01"
+	if err := acct.UpdateAccountTrie([]string{key}, []stgcommon.Type{noncommutative.NewInt64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	root := acct.GetStorageRoot()
+
+	// The trie and the dirty flag are kept when the db fails.
+	if err := acct.Commit(1); err == nil {
+		t.Fatal("Error: The commit should have failed")
+	}
+
+	if !acct.StorageDirty || acct.GetStorageRoot() != root {
+		t.Fatal("Error: The account should still be dirty with the same root")
+	}
+
+	db.failing = false
+	if err := acct.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if acct.StorageDirty || acct.GetStorageRoot() != root {
+		t.Error("Error: The account should have been committed with the same root")
+	}
+
+	if v, err := acct.Retrive(key, new(noncommutative.Int64)); err != nil || *v.(*noncommutative.Int64) != 1 {
+		t.Error("Error: Wrong value after the retry", v, err)
+	}
+}
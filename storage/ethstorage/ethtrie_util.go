@@ -33,8 +33,10 @@ import (
 
 // ethapi "github.com/ethereum/go-ethereum/internal/ethapi"
 
+// commitToEthDB writes the trie to the db and returns a new trie opened at the committed root. A committed trie
+// can't be used anymore, so a copy is committed instead and the trie stays usable for a retry if any step fails.
 func commitToEthDB(trie *ethmpt.Trie, ethdb *triedb.Database, block uint64) (*ethmpt.Trie, error) {
-	root, nodes, err := trie.Commit(false) // Finalized the trie
+	root, nodes, err := trie.Copy().Commit(false) // Finalized the trie
 	if err != nil {
 		return nil, errors.Join(errors.New("trie.Commit:"), err)
 	}
@@ -55,8 +57,9 @@ func commitToEthDB(trie *ethmpt.Trie, ethdb *triedb.Database, block uint64) (*et
 	return newTrie, err
 }
 
+// parallelcommitToEthDB is the same as commitToEthDB, the trie is left untouched on failure.
 func parallelcommitToEthDB(trie *ethmpt.Trie, ethdb *triedb.Database, block uint64) (*ethmpt.Trie, error) {
-	root, nodes, err := trie.Commit(false) // Finalized the trie
+	root, nodes, err := trie.Copy().Commit(false) // Finalized the trie
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +18,7 @@ package livecache
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 
 	"github.com/arcology-network/common-lib/exp/associative"
@@ -73,6 +74,24 @@ func (this *LiveCache) CacheChecksum() [32]byte {
 	return this.ReadCache.Checksum(less, encoders)
 }
 
+// SimulateChecksum returns the checksum the cache would have after the univalues are committed. The entries are
+// copied to a temporary cache first, so the cache itself is left unchanged. The memory limit isn't applied.
+func (this *LiveCache) SimulateChecksum(univals []*univalue.Univalue) [32]byte {
+	view := NewLiveCache(math.MaxUint64)
+	view.ReadCache.Commit(this.ReadCache.KVs())
+
+	keys := make([]string, len(univals))
+	pairedVals := make([]*associative.Pair[stgcommon.Type, *Profile], len(univals))
+	for i, v := range univals {
+		keys[i] = *v.GetPath()
+		if v.Value() != nil {
+			pairedVals[i] = &associative.Pair[stgcommon.Type, *Profile]{First: v.Value().(stgcommon.Type), Second: &Profile{}}
+		}
+	}
+	view.ReadCache.Commit(keys, pairedVals)
+	return view.CacheChecksum()
+}
+
 func (this *LiveCache) Delete(keys []string) {
 	this.ReadCache.BatchSet(keys, make([]*associative.Pair[stgcommon.Type, *Profile], len(keys)))
 }
@@ -17,7 +17,10 @@
 
 package livecache
 
-import "github.com/arcology-network/storage-committer/type/univalue"
+import (
+	"github.com/arcology-network/common-lib/exp/slice"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
 
 // LiveCacheWriter writes to the LiveCache.
 
@@ -27,6 +30,7 @@ type LiveCacheWriter struct {
 	buffer    []*LiveCacheIndexer           // For multiple generations. Each geneartion has its own indexer.
 	version   int64                         // The version of the indexer, used for debugging and tracking.
 	filter    func(*univalue.Univalue) bool // Filter function to select transitions to be indexed
+	written   uint64                        // The number of transitions written in the last block.
 }
 
 func NewLiveCacheWriter(cache *LiveCache, version int64, filter func(*univalue.Univalue) bool) *LiveCacheWriter {
@@ -50,9 +54,9 @@ func (this *LiveCacheWriter) Import(transitions []*univalue.Univalue) {
 // Send the data to the downstream processor, this is called for each generation.
 // If there are multiple generations, this can be called multiple times before Await.
 // Each generation
-func (this *LiveCacheWriter) Precommit(isSync bool) {
+func (this *LiveCacheWriter) Precommit(isSync bool) error {
 	if !this.liveCache.Status() {
-		return // Cache is disabled, do nothing.
+		return nil // Cache is disabled, do nothing.
 	}
 
 	if isSync {
@@ -62,18 +66,42 @@ func (this *LiveCacheWriter) Precommit(isSync bool) {
 		this.buffer = append(this.buffer, this.LiveCacheIndexer)                     // Append the indexer to the buffer
 		this.LiveCacheIndexer = NewLiveCacheIndexer(this.liveCache, -1, this.filter) // Reset the indexer with a default version number
 	}
+	return nil
 }
 
 // Triggered by the block commit.
-func (this *LiveCacheWriter) Commit(block uint64) {
+func (this *LiveCacheWriter) Commit(block uint64) error {
+	this.written = 0
 	if !this.liveCache.Status() {
-		return // Cache is disabled, do nothing.
+		return nil // Cache is disabled, do nothing.
 	}
 
 	merged := new(LiveCacheIndexer).Merge(this.buffer) // Merge indexers
 	this.liveCache.Commit(merged.buffer, block)        // commit univalues directly
-	this.buffer = make([]*LiveCacheIndexer, 0)         // Reset the indexer buffer
+	this.written = uint64(len(merged.buffer))
+	this.buffer = make([]*LiveCacheIndexer, 0) // Reset the indexer buffer
+	return nil
+}
+
+// RevertGeneration drops the buffered indexers of the generation and all the generations after it,
+// along with the transitions imported but not precommitted yet.
+func (this *LiveCacheWriter) RevertGeneration(gen uint64) {
+	this.buffer = this.buffer[:min(int(gen), len(this.buffer))]
+	this.LiveCacheIndexer = NewLiveCacheIndexer(this.liveCache, -1, this.filter)
+}
+
+// Simulate returns the checksum the cache would have after the precommitted generations and the pending transitions
+// are committed. The cache itself isn't changed. It is empty if the cache is disabled.
+func (this *LiveCacheWriter) Simulate() ([32]byte, error) {
+	if !this.liveCache.Status() {
+		return [32]byte{}, nil
+	}
+
+	merged := new(LiveCacheIndexer).Merge(this.buffer)
+	pending := slice.CopyIf(this.LiveCacheIndexer.importBuffer, func(_ int, v *univalue.Univalue) bool { return v.GetPath() != nil })
+	return this.liveCache.SimulateChecksum(append(merged.buffer, pending...)), nil
 }
 
-func (this *LiveCacheWriter) IsSync() bool { return true }
-func (this *LiveCacheWriter) Name() string { return "Live Cache Writer" }
+func (this *LiveCacheWriter) Written() (uint64, uint64) { return this.written, 0 } // In memory only.
+func (this *LiveCacheWriter) IsSync() bool              { return true }
+func (this *LiveCacheWriter) Name() string              { return "Live Cache Writer" }
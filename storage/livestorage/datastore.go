@@ -19,6 +19,7 @@ package ccstorage
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/cespare/xxhash/v2"
 
@@ -31,6 +32,9 @@ type LiveStorage struct {
 	db    commonintf.PersistentStorage
 	cache *cache.ReadCache[string, any]
 
+	stageLock sync.RWMutex
+	staged    []*map[string]any // The batches handed over to the detached writers but not in the db yet, oldest first.
+
 	encoder func(string, any) []byte
 	decoder func(string, []byte, any) any
 }
@@ -110,6 +114,11 @@ func (this *LiveStorage) ReadStorage(key string, T any) (any, error) {
 }
 
 func (this *LiveStorage) Retrive(key string, T any) (any, error) {
+	// The values not written to the db yet are the latest.
+	if v, ok := this.getStaged(key); ok {
+		return v, nil
+	}
+
 	// Read from the local cache first
 	if v, _ := this.cache.Get(key); v != nil {
 		return *v, nil
@@ -123,8 +132,20 @@ func (this *LiveStorage) Retrive(key string, T any) (any, error) {
 }
 
 func (this *LiveStorage) BatchRetrive(keys []string, T []any) []any {
-	values, _ := this.cache.BatchGet(keys) // From the local cache first
-	if slice.Count(values, nil) == 0 {     // All found
+	if this.hasStaged() { // Go through the staged batches first.
+		values := make([]any, len(keys))
+		for i, k := range keys {
+			var typed any
+			if len(T) > 0 {
+				typed = T[i]
+			}
+			values[i], _ = this.Retrive(k, typed)
+		}
+		return values
+	}
+
+	values, _ := this.cache.BatchGet(keys)               // From the local cache first
+	if slice.Count(values, nil) == 0 || this.db == nil { // All found or nowhere else to look
 		return values
 	}
 
@@ -151,3 +172,41 @@ func (this *LiveStorage) BatchRetrive(keys []string, T []any) []any {
 	}
 	return values
 }
+
+// Make a batch readable before it is written to the db. The batch is returned for unstaging.
+func (this *LiveStorage) stage(keys []string, values []any) *map[string]any {
+	batch := make(map[string]any, len(keys))
+	for i, k := range keys {
+		batch[k] = values[i]
+	}
+
+	this.stageLock.Lock()
+	defer this.stageLock.Unlock()
+	this.staged = append(this.staged, &batch)
+	return &batch
+}
+
+// Remove the batch once it is in the db and the local cache.
+func (this *LiveStorage) unstage(batch *map[string]any) {
+	this.stageLock.Lock()
+	defer this.stageLock.Unlock()
+	slice.Remove(&this.staged, batch)
+}
+
+// Get the value from the latest batch containing the key. A nil value means the key has been deleted.
+func (this *LiveStorage) getStaged(key string) (any, bool) {
+	this.stageLock.RLock()
+	defer this.stageLock.RUnlock()
+	for i := len(this.staged) - 1; i >= 0; i-- {
+		if v, ok := (*this.staged[i])[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (this *LiveStorage) hasStaged() bool {
+	this.stageLock.RLock()
+	defer this.stageLock.RUnlock()
+	return len(this.staged) > 0
+}
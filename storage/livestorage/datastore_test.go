@@ -18,12 +18,15 @@
 package ccstorage
 
 import (
+	"errors"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/arcology-network/common-lib/codec"
 	filedb "github.com/arcology-network/common-lib/storage/filedb"
+	commonintf "github.com/arcology-network/common-lib/storage/interface"
+	memdb "github.com/arcology-network/common-lib/storage/memdb"
 )
 
 var (
@@ -203,3 +206,72 @@ func TestAsyncCommitter(t *testing.T) {
 		t.Error("Error: Values mismatched !")
 	}
 }
+
+func TestDatastoreStaged(t *testing.T) {
+	store := NewLiveStorage(nil, nil, nil)
+	batch := store.stage([]string{"k0", "k1"}, []any{"v0", nil})
+	if v, err := store.Retrive("k0", nil); v != "v0" || err != nil {
+		t.Error("Error: Expected the staged value, got", v, err)
+	}
+
+	if v, err := store.Retrive("k1", nil); v != nil || err != nil {
+		t.Error("Error: Expected the key to be deleted, got", v, err)
+	}
+
+	newer := store.stage([]string{"k0"}, []any{"v1"})
+	if v, _ := store.Retrive("k0", nil); v != "v1" {
+		t.Error("Error: Expected the value from the latest batch, got", v)
+	}
+
+	store.unstage(newer)
+	if v, _ := store.Retrive("k0", nil); v != "v0" {
+		t.Error("Error: Expected the value from the earlier batch, got", v)
+	}
+
+	store.unstage(batch)
+	if store.hasStaged() {
+		t.Error("Error: Expected no staged batches")
+	}
+}
+
+type failingDB struct{ commonintf.PersistentStorage }
+
+func (this *failingDB) BatchSet([]string, [][]byte) error {
+	return errors.New("Error: Failed to write")
+}
+
+func TestDetachedWriterFailure(t *testing.T) {
+	store := NewLiveStorage(&failingDB{memdb.NewMemoryDB()}, nil, nil)
+	writer := NewLiveStorageWriter(store, -1, nil)
+	writer.staged = store.stage([]string{"k0"}, []any{"v0"}) // As if handed over by Detach().
+
+	if err := writer.Commit(1); err == nil {
+		t.Fatal("Error: The commit should have failed")
+	}
+
+	// The value isn't in the db, it mustn't be served to the reads anymore.
+	if store.hasStaged() {
+		t.Error("Error: The batch should have been unstaged")
+	}
+}
+
+func TestWriterStatsReset(t *testing.T) {
+	store := NewLiveStorage(&failingDB{memdb.NewMemoryDB()}, nil, nil)
+	writer := NewLiveStorageWriter(store, -1, nil)
+	writer.written, writer.writtenBytes = 5, 50 // From the previous block.
+
+	if err := writer.Commit(2); err == nil {
+		t.Fatal("Error: The commit should have failed")
+	}
+
+	if count, bytes := writer.Written(); count != 0 || bytes != 0 {
+		t.Error("Error: Nothing should be reported after a failed commit", count, bytes)
+	}
+
+	// The block is committed by the detached writer.
+	writer.written = 5
+	writer.Detach()
+	if count, _ := writer.Written(); count != 0 {
+		t.Error("Error: Nothing should be reported after the block is detached", count)
+	}
+}
@@ -17,7 +17,10 @@
 
 package ccstorage
 
-import "github.com/arcology-network/storage-committer/type/univalue"
+import (
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/arcology-network/storage-committer/type/univalue"
+)
 
 // LiveStorageWriter is a struct that contains data structure and methods for writing data to concurrent storage.
 // It manages buffered writes and supports both synchronous and asynchronous commit operations to the underlying storage.
@@ -27,6 +30,11 @@ type LiveStorageWriter struct {
 	store   *LiveStorage
 	version int64
 	filter  func(*univalue.Univalue) bool
+
+	written      uint64 // The number of transitions written in the last block.
+	writtenBytes uint64 // The number of bytes of the keys and the encoded values written to the db in the last block.
+
+	staged *map[string]any // The batch readable from the store before it is committed, detached writers only.
 }
 
 func NewLiveStorageWriter(store *LiveStorage, version int64, filter func(*univalue.Univalue) bool) *LiveStorageWriter {
@@ -41,7 +49,7 @@ func NewLiveStorageWriter(store *LiveStorage, version int64, filter func(*unival
 
 // Send the data to the downstream processor. This can be called multiple times
 // before calling Await to commit the data to the state db.
-func (this *LiveStorageWriter) Precommit(isSync bool) {
+func (this *LiveStorageWriter) Precommit(isSync bool) error {
 	if isSync {
 		this.LiveStgIndexer.PreCommit()
 	} else {
@@ -49,20 +57,66 @@ func (this *LiveStorageWriter) Precommit(isSync bool) {
 		this.buffer = append(this.buffer, this.LiveStgIndexer)
 		this.LiveStgIndexer = NewLiveStgIndexer(this.store, -1, this.filter)
 	}
+	return nil
 }
 
-// Await commits the data to the state db.
-func (this *LiveStorageWriter) Commit(_ uint64) {
+// Await commits the data to the state db. Nothing is changed if the db fails, so it can be retried.
+// A detached writer unstages its batch on failure, so the reads don't see the values that aren't in the db.
+// The stats are reset first, nothing is reported as written if it fails.
+func (this *LiveStorageWriter) Commit(_ uint64) error {
+	this.written, this.writtenBytes = 0, 0
 	mergedIdxer := new(LiveStgIndexer).Merge(this.buffer)
-	var err error
 	if this.store.db != nil {
-		if err = this.store.db.BatchSet(mergedIdxer.keyBuffer, mergedIdxer.encodedBuffer); err != nil {
-			panic(err)
+		if err := this.store.db.BatchSet(mergedIdxer.keyBuffer, mergedIdxer.encodedBuffer); err != nil {
+			this.unstage()
+			return err
 		}
 	}
 	this.store.cache.BatchSet(mergedIdxer.keyBuffer, mergedIdxer.valueBuffer) // update the local cache
 	this.buffer = this.buffer[:0]
+	this.unstage() // In the db and the cache now.
+
+	this.written = uint64(len(mergedIdxer.keyBuffer))
+	if this.store.db != nil {
+		for i := range mergedIdxer.keyBuffer {
+			this.writtenBytes += uint64(len(mergedIdxer.keyBuffer[i]) + len(mergedIdxer.encodedBuffer[i]))
+		}
+	}
+	return nil
+}
+
+// RevertGeneration drops the buffered indexers of the generation and all the generations after it,
+// along with the transitions imported but not precommitted yet. A detached writer discards its staged batch too.
+func (this *LiveStorageWriter) RevertGeneration(gen uint64) {
+	this.buffer = this.buffer[:min(int(gen), len(this.buffer))]
+	this.LiveStgIndexer = NewLiveStgIndexer(this.store, -1, this.filter)
+	if len(this.buffer) == 0 {
+		this.unstage()
+	}
+}
+
+// Remove the staged batch of a detached writer from the store, if any.
+func (this *LiveStorageWriter) unstage() {
+	if this.staged != nil {
+		this.store.unstage(this.staged)
+		this.staged = nil
+	}
+}
+
+// Detach hands the buffered generations over to a new writer to commit in the background. They are
+// staged in the store, so the reads are served with the latest values before they are written to the db.
+// The stats of the block are with the detached writer, the writer itself has written nothing.
+func (this *LiveStorageWriter) Detach() stgcommon.Writer[*univalue.Univalue] {
+	this.written, this.writtenBytes = 0, 0
+	detached := NewLiveStorageWriter(this.store, this.version, this.filter)
+	detached.buffer = this.buffer
+
+	merged := new(LiveStgIndexer).Merge(this.buffer)
+	detached.staged = this.store.stage(merged.keyBuffer, merged.valueBuffer)
+	this.buffer = []*LiveStgIndexer{}
+	return detached
 }
 
-func (this *LiveStorageWriter) IsSync() bool { return false }
-func (this *LiveStorageWriter) Name() string { return "Live Storage Writer" }
+func (this *LiveStorageWriter) Written() (uint64, uint64) { return this.written, this.writtenBytes }
+func (this *LiveStorageWriter) IsSync() bool              { return false }
+func (this *LiveStorageWriter) Name() string              { return "Live Storage Writer" }
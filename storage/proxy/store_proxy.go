@@ -124,6 +124,26 @@ func (this *StorageProxy) Retrive(key string, v any) (any, error) {
 	return this.ReadStorage(key, v)
 }
 
+// BatchRetrive reads the values from the cache first, the ones not in the cache are loaded from the storage at once.
+func (this *StorageProxy) BatchRetrive(keys []string, T []any) []any {
+	values := make([]any, len(keys))
+	missing, missingT, idxes := []string{}, []any{}, []int{}
+	for i, key := range keys {
+		if v, ok := this.execCache.Get(key); ok {
+			values[i] = v
+			continue
+		}
+		missing, missingT, idxes = append(missing, key), append(missingT, T[i]), append(idxes, i)
+	}
+
+	if len(missing) > 0 {
+		for i, v := range this.execStorage.BatchRetrive(missing, missingT) {
+			values[idxes[i]] = v
+		}
+	}
+	return values
+}
+
 func (this *StorageProxy) EthStore() *ethstg.EthDataStore { return this.ethStorage } // Eth storage
 
 func (this *StorageProxy) Preload(data []byte) any {
@@ -22,6 +22,10 @@ const (
 	INT64   uint8 = 101
 	UINT64  uint8 = 102
 	UINT256 uint8 = 103
+	INT256  uint8 = 110 // 104 ~ 109 are taken by the noncommutative types
+
+	MAX_REGISTER uint8 = 111
+	MIN_REGISTER uint8 = 112
 
 	RANGE              = 9
 	GROWONLY_SET uint8 = 50 // 50 ~
@@ -0,0 +1,203 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sort"
+
+	common "github.com/arcology-network/common-lib/common"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+)
+
+// GrowOnlySet is a set that elements can only be added to, never removed. Adding an element is a delta write,
+// the sets of all the transactions are merged into the committed one by union, so concurrent inserts never conflict.
+// It is good for registries and allowlists. A set can only be deleted as a whole.
+type GrowOnlySet struct {
+	value map[string]struct{} // The committed elements
+	delta map[string]struct{} // The elements added in the current generation
+}
+
+// NewGrowOnlySet creates a set with the elements added as the delta, they are committed with the transition.
+// It is also used as the delta to add the elements to an existing set.
+func NewGrowOnlySet(elems ...string) stgcommon.Type {
+	return &GrowOnlySet{value: map[string]struct{}{}, delta: toElemSet(elems)}
+}
+
+// For the codec only, don't use it for other purposes
+func (this *GrowOnlySet) New(value, delta, _, _, _ any) any {
+	return &GrowOnlySet{
+		value: toElemSet(common.IfThenDo1st(value != nil, func() []string { return value.([]string) }, nil)),
+		delta: toElemSet(common.IfThenDo1st(delta != nil, func() []string { return delta.([]string) }, nil)),
+	}
+}
+
+func (this *GrowOnlySet) Clone() any {
+	return &GrowOnlySet{value: toElemSet(this.Committed()), delta: toElemSet(this.Added())}
+}
+
+func (this *GrowOnlySet) Equal(other any) bool {
+	return equalElemSets(this.value, other.(*GrowOnlySet).value) && equalElemSets(this.delta, other.(*GrowOnlySet).delta)
+}
+
+func (this *GrowOnlySet) MemSize() uint64 {
+	size := uint64(16)
+	for elem := range this.value {
+		size += uint64(len(elem)) + 16
+	}
+
+	for elem := range this.delta {
+		size += uint64(len(elem)) + 16
+	}
+	return size
+}
+
+func (this *GrowOnlySet) IsNumeric() bool     { return false }
+func (this *GrowOnlySet) IsCommutative() bool { return true }
+
+func (this *GrowOnlySet) Value() any         { return this.Committed() }
+func (this *GrowOnlySet) Delta() (any, bool) { return this.Added(), true }
+func (this *GrowOnlySet) Limits() (any, any) { return nil, nil }
+
+func (this *GrowOnlySet) IsDeltaApplied() bool    { return len(this.delta) == 0 }
+func (this *GrowOnlySet) CloneDelta() (any, bool) { return this.Added(), true }
+func (this *GrowOnlySet) ResetDelta()             { this.delta = map[string]struct{}{} }
+func (this *GrowOnlySet) Preload(_ string, _ any) {}
+
+func (this *GrowOnlySet) SetValue(v any)         { this.value = toElemSet(v.([]string)) }
+func (this *GrowOnlySet) SetDelta(v any, _ bool) { this.delta = toElemSet(v.([]string)) }
+
+func (this *GrowOnlySet) TypeID() uint8                              { return GROWONLY_SET }
+func (this *GrowOnlySet) IsDeletable(key, path any) bool             { return true }
+func (this *GrowOnlySet) CopyTo(v any) (any, uint32, uint32, uint32) { return v, 0, 1, 0 }
+func (*GrowOnlySet) GetCascadeSub(_ string, _ any) []string          { return nil }
+
+// Committed returns the committed elements in order.
+func (this *GrowOnlySet) Committed() []string { return sortedElems(this.value) }
+
+// Added returns the elements added in the current generation but not committed yet, in order.
+func (this *GrowOnlySet) Added() []string { return sortedElems(this.delta) }
+
+// Length returns the number of the elements, including the ones not committed yet.
+func (this *GrowOnlySet) Length() int { return len(this.value) + len(this.delta) }
+
+func (this *GrowOnlySet) Contains(elem string) bool {
+	_, committed := this.value[elem]
+	_, added := this.delta[elem]
+	return committed || added
+}
+
+// Get returns all the elements in order, including the ones not committed yet.
+func (this *GrowOnlySet) Get() (any, uint32, uint32) {
+	elems := make([]string, 0, this.Length())
+	for elem := range this.value {
+		elems = append(elems, elem)
+	}
+
+	for elem := range this.delta {
+		elems = append(elems, elem)
+	}
+	sort.Strings(elems)
+	return elems, 1, common.IfThen(len(this.delta) == 0, uint32(0), uint32(1))
+}
+
+// Set adds the elements of the other set to the delta, the ones in the set already are ignored.
+// A nil value deletes the whole set.
+func (this *GrowOnlySet) Set(v any, source any) (any, uint32, uint32, uint32, error) {
+	if v == nil {
+		return this, 0, 1, 0, nil
+	}
+
+	other, ok := v.(*GrowOnlySet)
+	if !ok {
+		return this, 0, 1, 0, errors.New("Error: Not a GrowOnlySet")
+	}
+
+	for _, elems := range []map[string]struct{}{other.value, other.delta} {
+		for elem := range elems {
+			if !this.Contains(elem) {
+				this.delta[elem] = struct{}{}
+			}
+		}
+	}
+	return this, 0, 0, 1, nil
+}
+
+// ApplyDelta merges the elements added by all the transitions into the committed ones. The union is commutative,
+// so the order of the transitions doesn't matter.
+func (this *GrowOnlySet) ApplyDelta(typedVals []stgcommon.Type) (stgcommon.Type, int, error) {
+	for i, v := range typedVals {
+		if this == nil && v != nil { // New value
+			this = v.(*GrowOnlySet)
+		}
+
+		if this != nil && v != nil {
+			if _, _, _, _, err := this.Set(v, nil); err != nil {
+				return nil, i, err
+			}
+		}
+
+		if this != nil && v == nil {
+			this = nil
+		}
+	}
+
+	if this == nil {
+		return nil, 0, errors.New("Error: Nil value")
+	}
+
+	for elem := range this.delta {
+		this.value[elem] = struct{}{}
+	}
+	this.ResetDelta()
+	return this, len(typedVals), nil
+}
+
+func (this *GrowOnlySet) Hash() [32]byte            { return sha256.Sum256(this.Encode()) }
+func (this *GrowOnlySet) ShortHash() (uint64, bool) { return 0, false }
+
+func toElemSet(elems []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(elems))
+	for _, elem := range elems {
+		set[elem] = struct{}{}
+	}
+	return set
+}
+
+func sortedElems(set map[string]struct{}) []string {
+	elems := make([]string, 0, len(set))
+	for elem := range set {
+		elems = append(elems, elem)
+	}
+	sort.Strings(elems)
+	return elems
+}
+
+func equalElemSets(lhv, rhv map[string]struct{}) bool {
+	if len(lhv) != len(rhv) {
+		return false
+	}
+
+	for elem := range lhv {
+		if _, ok := rhv[elem]; !ok {
+			return false
+		}
+	}
+	return true
+}
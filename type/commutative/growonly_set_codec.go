@@ -0,0 +1,111 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"fmt"
+
+	codec "github.com/arcology-network/common-lib/codec"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func (this *GrowOnlySet) HeaderSize() uint64 {
+	return 3 * codec.UINT64_LEN // number of fields + 1
+}
+
+func (this *GrowOnlySet) Size() uint64 {
+	return this.HeaderSize() + elemsSize(this.value) + elemsSize(this.delta)
+}
+
+func (this *GrowOnlySet) Encode() []byte {
+	buffer := make([]byte, this.Size())
+	this.EncodeTo(buffer)
+	return buffer
+}
+
+func (this *GrowOnlySet) EncodeTo(buffer []byte) int {
+	offset := codec.Encoder{}.FillHeader(buffer, []uint64{elemsSize(this.value), elemsSize(this.delta)})
+	offset += encodeElems(this.Committed(), buffer[offset:])
+	offset += encodeElems(this.Added(), buffer[offset:])
+	return offset
+}
+
+func (*GrowOnlySet) Decode(buffer []byte) any {
+	if len(buffer) == 0 {
+		return NewGrowOnlySet()
+	}
+
+	fields := codec.Byteset{}.Decode(buffer).(codec.Byteset)
+	return &GrowOnlySet{
+		value: toElemSet(decodeElems(fields[0])),
+		delta: toElemSet(decodeElems(fields[1])),
+	}
+}
+
+func (this *GrowOnlySet) Print() {
+	fmt.Println("Committed: ", codec.Strings(this.Committed()).ToHex())
+	fmt.Println("Added: ", codec.Strings(this.Added()).ToHex())
+	fmt.Println()
+}
+
+// Only the committed elements are persisted, in order, so the same set always has the same encoding.
+func (this *GrowOnlySet) StorageEncode(_ string) []byte {
+	buffer, _ := rlp.EncodeToBytes(this.Committed())
+	return buffer
+}
+
+func (*GrowOnlySet) StorageDecode(_ string, buffer []byte) any {
+	var elems []string
+	rlp.DecodeBytes(buffer, &elems)
+	return &GrowOnlySet{value: toElemSet(elems), delta: map[string]struct{}{}}
+}
+
+// The elements are encoded in the same layout as a codec.Byteset, a header of the lengths followed by the elements.
+func elemsSize(set map[string]struct{}) uint64 {
+	size := uint64(len(set)+1) * codec.UINT64_LEN
+	for elem := range set {
+		size += uint64(len(elem))
+	}
+	return size
+}
+
+func encodeElems(elems []string, buffer []byte) int {
+	lengths := make([]uint64, len(elems))
+	for i, elem := range elems {
+		lengths[i] = uint64(len(elem))
+	}
+
+	offset := codec.Encoder{}.FillHeader(buffer, lengths)
+	for _, elem := range elems {
+		offset += copy(buffer[offset:], elem)
+	}
+	return offset
+}
+
+func decodeElems(buffer []byte) []string {
+	if uint64(len(buffer)) <= codec.UINT64_LEN { // No elements.
+		return nil
+	}
+
+	fields := codec.Byteset{}.Decode(buffer).(codec.Byteset)
+	elems := make([]string, len(fields))
+	for i, field := range fields {
+		elems[i] = string(field)
+	}
+	return elems
+}
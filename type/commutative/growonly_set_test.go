@@ -0,0 +1,69 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"slices"
+	"testing"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+)
+
+func TestGrowOnlySet(t *testing.T) {
+	set := NewGrowOnlySet("b").(*GrowOnlySet)
+	set.ApplyDelta([]stgcommon.Type{set})
+
+	// Concurrent inserts from different transactions, with an overlapping element.
+	_, _, _, deltaWrites, _ := set.Clone().(*GrowOnlySet).Set(NewGrowOnlySet("a", "c"), nil)
+	if deltaWrites != 1 {
+		t.Error("Error: Adding elements should be a delta write", deltaWrites)
+	}
+
+	merged, _, err := set.ApplyDelta([]stgcommon.Type{NewGrowOnlySet("c", "a"), NewGrowOnlySet("d", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elems := merged.(*GrowOnlySet).Committed(); !slices.Equal(elems, []string{"a", "b", "c", "d"}) || !merged.IsDeltaApplied() {
+		t.Error("Error: Wrong elements", elems)
+	}
+
+	if _, _, err := set.ApplyDelta([]stgcommon.Type{NewGrowOnlySet("e"), nil}); err == nil {
+		t.Error("Error: The set should have been deleted")
+	}
+}
+
+func TestGrowOnlySetCodec(t *testing.T) {
+	set := NewGrowOnlySet("0x01", "0x02").(*GrowOnlySet)
+	set.ApplyDelta([]stgcommon.Type{set})
+	set.Set(NewGrowOnlySet("0x03"), nil)
+
+	if decoded := (&GrowOnlySet{}).Decode(set.Encode()).(*GrowOnlySet); !decoded.Equal(set) {
+		t.Error("Error: Mismatched", decoded.Committed(), decoded.Added())
+	}
+
+	// Only the committed elements are persisted.
+	stored := (&GrowOnlySet{}).StorageDecode("", set.StorageEncode("")).(*GrowOnlySet)
+	if !slices.Equal(stored.Committed(), []string{"0x01", "0x02"}) || len(stored.Added()) != 0 {
+		t.Error("Error: Mismatched", stored.Committed(), stored.Added())
+	}
+
+	if empty := (&GrowOnlySet{}).Decode(NewGrowOnlySet().Encode()).(*GrowOnlySet); empty.Length() != 0 {
+		t.Error("Error: Should be empty", empty.Committed())
+	}
+}
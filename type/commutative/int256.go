@@ -0,0 +1,258 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/arcology-network/common-lib/common"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	uint256 "github.com/holiman/uint256"
+)
+
+var (
+	INT256_MIN = *new(uint256.Int).Lsh(uint256.NewInt(1), 255)                                          // -2^255, default limits
+	INT256_MAX = *new(uint256.Int).Sub(new(uint256.Int).Lsh(uint256.NewInt(1), 255), uint256.NewInt(1)) // 2^255 - 1
+)
+
+// Int256 is a signed 256-bit commutative integer. The value and the limits are in two's complement, the same as
+// the int256 in the EVM. The delta is in the sign-magnitude form like the one of U256, so the overflow and
+// underflow of the accumulated delta are detected in the same way.
+type Int256 struct {
+	value         uint256.Int
+	delta         uint256.Int
+	min           uint256.Int
+	max           uint256.Int
+	deltaPositive bool
+}
+
+func NewUnboundedInt256() stgcommon.Type {
+	return &Int256{
+		min:           INT256_MIN,
+		max:           INT256_MAX,
+		deltaPositive: true,
+	}
+}
+
+// NewBoundedInt256 creates an Int256 with the limits, an unbounded one if the limits are invalid.
+func NewBoundedInt256(lower, upper *big.Int) stgcommon.Type {
+	v := NewUnboundedInt256().(*Int256)
+	min, minOk := FromSignedBig(lower)
+	max, maxOk := FromSignedBig(upper)
+	if minOk && maxOk && upper.Cmp(lower) >= 0 { // The upper limit has to be greater than the lower one
+		v.min = *min
+		v.max = *max
+	}
+	return v
+}
+
+func NewInt256Delta(delta *uint256.Int, deltaPositive bool) stgcommon.Type {
+	return &Int256{
+		delta:         *delta,
+		deltaPositive: deltaPositive,
+	}
+}
+
+func NewInt256DeltaFromBigInt(delta *big.Int) (any, bool) {
+	deltaV, overflowed := uint256.FromBig(new(big.Int).Abs(delta))
+	if overflowed {
+		return nil, false
+	}
+
+	return &Int256{
+		delta:         *deltaV,
+		deltaPositive: delta.Sign() != -1, // >= 0
+	}, true
+}
+
+func (this *Int256) New(value, delta, sign, min, max any) any {
+	return &Int256{
+		value:         common.IfThenDo1st(value != nil, func() uint256.Int { return value.(uint256.Int) }, *U256_ZERO.Clone()),
+		delta:         common.IfThenDo1st(delta != nil, func() uint256.Int { return delta.(uint256.Int) }, *U256_ZERO.Clone()),
+		deltaPositive: common.IfThenDo1st(sign != nil, func() bool { return sign.(bool) }, true),
+		min:           common.IfThenDo1st(min != nil, func() uint256.Int { return min.(uint256.Int) }, INT256_MIN),
+		max:           common.IfThenDo1st(max != nil, func() uint256.Int { return max.(uint256.Int) }, INT256_MAX),
+	}
+}
+
+func (this *Int256) IsNumeric() bool     { return true }
+func (this *Int256) IsCommutative() bool { return true }
+func (this *Int256) HasLimits() bool     { return !this.min.Eq(&INT256_MIN) || !this.max.Eq(&INT256_MAX) }
+
+func (this *Int256) Value() any         { return this.value }
+func (this *Int256) Delta() (any, bool) { return this.delta, this.deltaPositive }
+func (this *Int256) Limits() (any, any) { return this.min, this.max }
+
+func (this *Int256) CloneDelta() (any, bool) { return *this.delta.Clone(), this.deltaPositive }
+func (this *Int256) SetValue(v any)          { this.value = (v.(uint256.Int)) }
+func (this *Int256) Preload(_ string, _ any) {}
+
+func (this *Int256) IsDeltaApplied() bool { return this.delta.IsZero() }
+func (this *Int256) ResetDelta()          { this.SetDelta(*U256_ZERO.Clone(), true) }
+
+func (this *Int256) SetDelta(v any, sign bool) {
+	this.delta = (v.(uint256.Int))
+	this.deltaPositive = sign
+}
+
+func (this *Int256) MemSize() uint64                            { return 4*32 + 1 } // in bytes
+func (this *Int256) IsDeletable(key, path any) bool             { return true }
+func (this *Int256) TypeID() uint8                              { return INT256 }
+func (this *Int256) CopyTo(v any) (any, uint32, uint32, uint32) { return v, 0, 1, 0 }
+func (*Int256) GetCascadeSub(_ string, _ any) []string          { return nil }
+
+func (this *Int256) Hash() [32]byte            { return sha256.Sum256(this.Encode()) }
+func (this *Int256) ShortHash() (uint64, bool) { return 0, false }
+
+func (this *Int256) Clone() any {
+	return &Int256{
+		value:         *this.value.Clone(),
+		delta:         *this.delta.Clone(),
+		min:           *this.min.Clone(),
+		max:           *this.max.Clone(),
+		deltaPositive: this.deltaPositive,
+	}
+}
+
+func (this *Int256) Equal(other any) bool {
+	return this.value.Eq(&other.(*Int256).value) &&
+		this.delta.Eq(&other.(*Int256).delta) &&
+		this.deltaPositive == other.(*Int256).deltaPositive &&
+		this.min.Eq(&other.(*Int256).min) &&
+		this.max.Eq(&other.(*Int256).max)
+}
+
+// Get returns the value with the delta applied, in two's complement.
+func (this *Int256) Get() (any, uint32, uint32) {
+	if this.delta.IsZero() {
+		return this.value, 1, 0 // delta is zero
+	}
+
+	if this.deltaPositive {
+		return *((&uint256.Int{}).Add(&this.value, &this.delta)), 1, 1
+	}
+	return *((&uint256.Int{}).Sub(&this.value, &this.delta)), 1, 1
+}
+
+// Signed returns the value with the delta applied as a big.Int.
+func (this *Int256) Signed() *big.Int {
+	v, _, _ := this.Get()
+	return ToSignedBig(common.New(v.(uint256.Int)))
+}
+
+func (this *Int256) isOverflowed(lhv *uint256.Int, lhvSign bool, rhv *uint256.Int, rhvSign bool) (*uint256.Int, bool) {
+	return addSignMagnitude(lhv, lhvSign, rhv, rhvSign)
+}
+
+// Set delta
+func (this *Int256) Set(newDelta any, source any) (any, uint32, uint32, uint32, error) {
+	if newDelta == nil {
+		return this, 0, 1, 0, nil
+	}
+
+	if newDelta.(*Int256).delta.IsZero() {
+		return this, 0, 0, 0, nil
+	}
+
+	accumDelta, isDeltaPositive := this.isOverflowed(this.delta.Clone(), this.deltaPositive, &newDelta.(*Int256).delta, newDelta.(*Int256).deltaPositive)
+	if accumDelta == nil {
+		return this, 0, 0, 1, errors.New("Error: The delta is overflowed")
+	}
+
+	accumVal := ToSignedBig(&this.value)
+	if isDeltaPositive {
+		accumVal.Add(accumVal, accumDelta.ToBig())
+	} else {
+		accumVal.Sub(accumVal, accumDelta.ToBig())
+	}
+
+	if accumVal.Cmp(ToSignedBig(&this.min)) < 0 {
+		return this, 0, 0, 1, errors.New("Error: The value is underflowed")
+	}
+
+	if accumVal.Cmp(ToSignedBig(&this.max)) > 0 {
+		return this, 0, 0, 1, errors.New("Error: The value is overflowed")
+	}
+
+	this.delta = *accumDelta
+	this.deltaPositive = isDeltaPositive
+	return this, 0, 0, 1, nil
+}
+
+func (this *Int256) ApplyDelta(typedVals []stgcommon.Type) (stgcommon.Type, int, error) {
+	for i, v := range typedVals {
+		if this == nil && v != nil { // New value
+			this = v.(*Int256)
+		}
+
+		if this != nil && v != nil { // Update an existent
+			if _, _, _, _, err := this.Set(v.(*Int256), nil); err != nil {
+				return nil, i, err
+			}
+		}
+
+		if this != nil && v == nil { // Delete an existent
+			this = nil
+		}
+	}
+
+	if this == nil {
+		return nil, 0, errors.New("Error: Nil value")
+	}
+
+	newValue, _, _ := this.Get()
+	this.value = (newValue.(uint256.Int))
+	this.ResetDelta()
+	return this, len(typedVals), nil
+}
+
+func (this *Int256) Print() {
+	fmt.Println(" Value: ", this.Signed(), " Delta: ", this.delta, "Delta Sign: ", this.deltaPositive)
+}
+
+// ToSignedBig converts an int256 in two's complement to a big.Int.
+func ToSignedBig(v *uint256.Int) *big.Int {
+	if v.Sign() >= 0 {
+		return v.ToBig()
+	}
+	abs := new(uint256.Int).Neg(v).ToBig() // -2^255 is its own negation, but still right as unsigned.
+	return abs.Neg(abs)
+}
+
+// FromSignedBig converts a big.Int to an int256 in two's complement, false if it is out of the int256 range.
+func FromSignedBig(v *big.Int) (*uint256.Int, bool) {
+	abs, overflowed := uint256.FromBig(new(big.Int).Abs(v))
+	if overflowed {
+		return nil, false
+	}
+
+	if v.Sign() < 0 {
+		if abs.Gt(&INT256_MIN) {
+			return nil, false
+		}
+		return abs.Neg(abs), true
+	}
+
+	if !abs.Lt(&INT256_MIN) {
+		return nil, false
+	}
+	return abs, true
+}
@@ -0,0 +1,119 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	codec "github.com/arcology-network/common-lib/codec"
+	"github.com/arcology-network/common-lib/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func (this *Int256) HeaderSize() uint64 {
+	return 5 // Total number of fields + offsets of these fields
+}
+
+func (this *Int256) Size() uint64 {
+	return this.HeaderSize() +
+		common.IfThen(this.value.IsZero(), 0, uint64(32)) + // Values
+		common.IfThen(this.delta.IsZero(), 0, uint64(32)) + // delta
+		common.IfThen(this.deltaPositive, 0, uint64(1)) + // delta sign
+		common.IfThen(this.min.Eq(&INT256_MIN), 0, uint64(32)) + // Min
+		common.IfThen(this.max.Eq(&INT256_MAX), 0, uint64(32)) // Max
+}
+
+func (this *Int256) Encode() []byte {
+	buffer := make([]byte, this.Size())
+	buffer[0] = common.IfThen(this.value.IsZero(), 0, uint8(32))
+	buffer[1] = common.IfThen(this.delta.IsZero(), 0, uint8(32))
+	buffer[2] = common.IfThen(this.deltaPositive, 0, uint8(1))
+	buffer[3] = common.IfThen(this.min.Eq(&INT256_MIN), 0, uint8(32))
+	buffer[4] = common.IfThen(this.max.Eq(&INT256_MAX), 0, uint8(32))
+
+	this.EncodeTo(buffer[5:])
+	return buffer
+}
+
+func (this *Int256) EncodeTo(buffer []byte) int {
+	offset := common.IfThenDo1st(!this.value.IsZero(), func() int { return codec.Uint64s(this.value[:]).EncodeTo(buffer) }, 0)
+	offset += common.IfThenDo1st(!this.delta.IsZero(), func() int { return codec.Uint64s(this.delta[:]).EncodeTo(buffer[offset:]) }, 0)
+	offset += common.IfThenDo1st(!this.deltaPositive, func() int { return codec.Bool(this.deltaPositive).EncodeTo(buffer[offset:]) }, 0)
+	offset += common.IfThenDo1st(!this.min.Eq(&INT256_MIN), func() int { return codec.Uint64s(this.min[:]).EncodeTo(buffer[offset:]) }, 0)
+	offset += common.IfThenDo1st(!this.max.Eq(&INT256_MAX), func() int { return codec.Uint64s(this.max[:]).EncodeTo(buffer[offset:]) }, 0)
+	return offset
+}
+
+func (this *Int256) Decode(buffer []byte) any {
+	if len(buffer) == 0 {
+		return this
+	}
+	this = NewUnboundedInt256().(*Int256)
+
+	offset := 5
+	if buffer[0] > 0 {
+		copy(this.value[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+		offset += int(buffer[0])
+	}
+
+	if buffer[1] > 0 {
+		copy(this.delta[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+		offset += int(buffer[1])
+	}
+
+	if buffer[2] > 0 {
+		this.deltaPositive = bool(codec.Bool(true).Decode(buffer[offset:]).(codec.Bool))
+		offset += int(buffer[2])
+	}
+
+	if buffer[3] > 0 {
+		copy(this.min[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+		offset += int(buffer[3])
+	}
+
+	if buffer[4] > 0 {
+		copy(this.max[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+	}
+	return this
+}
+
+// The values are stored as the 32-byte words in two's complement, since RLP doesn't support negative integers.
+func (this *Int256) StorageEncode(_ string) []byte {
+	var buffer []byte
+	if this.HasLimits() {
+		buffer, _ = rlp.EncodeToBytes([][]byte{this.value.Bytes(), this.min.Bytes(), this.max.Bytes()})
+	} else {
+		buffer, _ = rlp.EncodeToBytes(this.value.Bytes())
+	}
+	return buffer
+}
+
+func (*Int256) StorageDecode(_ string, buffer []byte) any {
+	this := NewUnboundedInt256().(*Int256)
+
+	var arr [][]byte
+	if err := rlp.DecodeBytes(buffer, &arr); err != nil {
+		var value []byte
+		if err = rlp.DecodeBytes(buffer, &value); err == nil {
+			this.value.SetBytes(value)
+		}
+	} else if len(arr) == 3 {
+		this.value.SetBytes(arr[0])
+		this.min.SetBytes(arr[1])
+		this.max.SetBytes(arr[2])
+	}
+	return this
+}
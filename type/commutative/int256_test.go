@@ -0,0 +1,104 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+func TestInt256(t *testing.T) {
+	v := NewBoundedInt256(big.NewInt(-10), big.NewInt(10)).(*Int256)
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(7), false), nil); err != nil { // -7
+		t.Error(err)
+	}
+
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(4), false), nil); err == nil { // -11
+		t.Error("Error: Should have underflowed")
+	}
+
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(18), true), nil); err == nil { // 11
+		t.Error("Error: Should have overflowed")
+	}
+
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(2), true), nil); err != nil { // -5
+		t.Error(err)
+	}
+
+	if v.Signed().Int64() != -5 {
+		t.Error("Error: Wrong value", v.Signed())
+	}
+
+	applied, _, err := v.ApplyDelta(nil)
+	if err != nil || applied.(*Int256).Signed().Int64() != -5 || !applied.IsDeltaApplied() {
+		t.Error("Error: Wrong value", applied, err)
+	}
+}
+
+func TestInt256Limits(t *testing.T) {
+	v := NewUnboundedInt256().(*Int256)
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+
+	delta, _ := NewInt256DeltaFromBigInt(max)
+	if _, _, _, _, err := v.Set(delta, nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(1), true), nil); err == nil {
+		t.Error("Error: Should have overflowed")
+	}
+
+	// All the way down to the minimum.
+	delta, _ = NewInt256DeltaFromBigInt(new(big.Int).Neg(max))
+	v.Set(delta, nil)
+	v.Set(delta, nil)
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(1), false), nil); err != nil {
+		t.Error(err)
+	}
+
+	if v.Signed().Cmp(new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))) != 0 {
+		t.Error("Error: Should be the minimum", v.Signed())
+	}
+
+	if _, _, _, _, err := v.Set(NewInt256Delta(uint256.NewInt(1), false), nil); err == nil {
+		t.Error("Error: Should have underflowed")
+	}
+}
+
+func TestInt256Codec(t *testing.T) {
+	v := NewBoundedInt256(big.NewInt(-100), big.NewInt(100)).(*Int256)
+	v.Set(NewInt256Delta(uint256.NewInt(37), false), nil)
+
+	if decoded := (&Int256{}).Decode(v.Encode()).(*Int256); !decoded.Equal(v) {
+		t.Error("Error: Mismatched")
+	}
+
+	v.ApplyDelta(nil)
+	stored := (&Int256{}).StorageDecode("", v.StorageEncode("")).(*Int256)
+	if !stored.Equal(v) || stored.Signed().Int64() != -37 {
+		t.Error("Error: Mismatched", stored.Signed())
+	}
+
+	unbounded := NewUnboundedInt256().(*Int256)
+	unbounded.SetValue(*new(uint256.Int).Neg(uint256.NewInt(5)))
+	if stored := (&Int256{}).StorageDecode("", unbounded.StorageEncode("")).(*Int256); !stored.Equal(unbounded) {
+		t.Error("Error: Mismatched", stored.Signed())
+	}
+}
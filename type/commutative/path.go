@@ -20,6 +20,7 @@ package commutative
 import (
 	"crypto/sha256"
 	"errors"
+	"sync/atomic"
 
 	codec "github.com/arcology-network/common-lib/codec"
 	"github.com/arcology-network/common-lib/common"
@@ -37,9 +38,11 @@ type Path struct {
 	Expression   string // type id
 	IsSysPath    bool   // If true, it is a system path, which may hold different types of elements.
 	isBlockBound bool   // If true, it is not persisted to the storage after each block
+	Ordering     uint8  // The key comparator of the container, ORDER_LEXICAL by default.
 
 	preloaded *orderedset.OrderedSet[string]
-	TotalSize uint64 // The size of the elements under the path in bytes.
+	sorted    atomic.Pointer[sortedKeys] // The committed keys in the order of the container. Committed paths are read concurrently.
+	TotalSize uint64                     // The size of the elements under the path in bytes.
 }
 
 func NewPath(newPaths ...string) stgcommon.Type {
@@ -71,6 +74,7 @@ func (this *Path) GetCascadeSub(prefix string, source any) []string {
 		}
 
 		for i := range subPaths {
+			pathStrs = append(pathStrs, subPaths[i]) // The sub path itself needs to be deleted too.
 			if path, _ := store.Retrive(subPaths[i], new(Path)); path != nil {
 				underSubPaths := path.(*Path).GetCascadeSub(subPaths[i], store)
 				pathStrs = append(pathStrs, underSubPaths...)
@@ -137,6 +141,7 @@ func (this *Path) Clone() any {
 		preloaded:    this.preloaded,
 		ElemType:     this.ElemType,
 		isBlockBound: this.isBlockBound,
+		Ordering:     this.Ordering,
 		TotalSize:    this.TotalSize,
 	}
 }
@@ -154,6 +159,7 @@ func (this *Path) New(_, _, _, _, _ any) any {
 		ElemType:     this.ElemType,
 		Expression:   this.Expression,
 		isBlockBound: this.isBlockBound,
+		Ordering:     this.Ordering,
 		TotalSize:    this.TotalSize,
 	}
 	return deltaSet
@@ -186,6 +192,7 @@ func (this *Path) ApplyDelta(typedVals []stgcommon.Type) (stgcommon.Type, int, e
 
 	deltaSets := slice.Transform(typedVals, func(_ int, v stgcommon.Type) *softdeltaset.DeltaSet[string] { return v.(*Path).DeltaSet })
 	this.Commit(deltaSets) // Apply the delta sets to the isCommitted value，including its own delta set.
+	this.sorted.Store(nil) // The committed keys have changed.
 	return this, len(typedVals), nil
 }
 
@@ -305,10 +312,14 @@ func (this *Path) ShortHash() (uint64, bool) {
 }
 
 // For Debug
-func (this *Path) SetSubPaths(keys []string)   { this.DeltaSet.InsertCommitted(keys) }
 func (this *Path) SetAdded(keys []string)      { this.DeltaSet.InsertAdded(keys) }
 func (this *Path) InsertRemoved(keys []string) { this.DeltaSet.InsertRemoved(keys) }
 
+func (this *Path) SetSubPaths(keys []string) {
+	this.DeltaSet.InsertCommitted(keys)
+	this.sorted.Store(nil)
+}
+
 func (this *Path) Keys() []string { // Committed keys
 	return common.IfThenDo1st(this.DeltaSet.Committed() != nil, func() []string { return this.DeltaSet.Committed().Elements() }, []string{})
 }
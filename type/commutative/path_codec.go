@@ -26,8 +26,12 @@ import (
 	// performance "github.com/arcology-network/common-lib/mhasher"
 )
 
+// The version of the path encoding. The paths encoded before the versioning end with the element type,
+// they are decoded as version 0 with the default ordering.
+const PATH_CODEC_VERSION uint8 = 1
+
 func (this *Path) HeaderSize() uint64 {
-	return 5 * codec.UINT64_LEN // number of fields + 1
+	return 7 * codec.UINT64_LEN // number of fields + 1
 }
 
 func (this *Path) Size() uint64 {
@@ -35,7 +39,9 @@ func (this *Path) Size() uint64 {
 		8 + // TotalSize
 		1 + // isBlockBound
 		uint64(this.DeltaSet.Size()) +
-		1 // 1 byte for element type ID
+		1 + // 1 byte for element type ID
+		1 + // 1 byte for the codec version
+		1 // 1 byte for the key ordering
 }
 
 func (this *Path) Encode() []byte {
@@ -51,13 +57,19 @@ func (this *Path) EncodeTo(buffer []byte) int {
 			1,
 			uint64(this.DeltaSet.Size()),
 			1,
+			1,
+			1,
 		},
 	)
 
 	offset += codec.Uint64(this.TotalSize).EncodeTo(buffer[offset:])
 	offset += codec.Bool(this.isBlockBound).EncodeTo(buffer[offset:])
 	this.DeltaSet.EncodeTo(buffer[offset:])
-	offset += 1
+	offset += int(this.DeltaSet.Size())
+	buffer[offset] = this.ElemType
+	buffer[offset+1] = PATH_CODEC_VERSION
+	buffer[offset+2] = this.Ordering
+	offset += 3
 
 	return offset
 }
@@ -73,6 +85,13 @@ func (*Path) Decode(buffer []byte) any {
 	path.isBlockBound = bool(codec.Bool(false).Decode(fields[1]).(codec.Bool))
 	path.DeltaSet = path.DeltaSet.Decode(fields[2]).(*softdeltaset.DeltaSet[string])
 	path.ElemType = uint8(fields[3][0])
+	if len(fields) <= 4 { // Version 0
+		return path
+	}
+
+	if version := uint8(fields[4][0]); version >= 1 {
+		path.Ordering = uint8(fields[5][0])
+	}
 	return path
 }
 
@@ -83,6 +102,7 @@ func (this *Path) Print() {
 	fmt.Println("Staged Added: ", codec.Strings(this.DeltaSet.Added().Elements()).ToHex())
 	fmt.Println("Staged Removed: ", codec.Strings(this.DeltaSet.Removed().Elements()).ToHex())
 	fmt.Println("Type: ", this.TypeID())
+	fmt.Println("Ordering: ", this.Ordering)
 	fmt.Println()
 }
 
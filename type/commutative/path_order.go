@@ -0,0 +1,222 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/arcology-network/common-lib/common"
+	"github.com/arcology-network/common-lib/exp/orderedset"
+	"github.com/arcology-network/common-lib/exp/slice"
+)
+
+// The orderings of the keys in a container. The ordering is persisted with the path meta,
+// so a container keeps the same ordering after being committed and loaded again.
+const (
+	ORDER_LEXICAL uint8 = 0 // Byte-wise comparison of the keys, the default.
+	ORDER_NUMERIC uint8 = 1 // Shorter keys go first, keys of the same length are compared byte-wise. For unpadded numbers.
+)
+
+var orderings = map[uint8]func(string, string) int{
+	ORDER_LEXICAL: strings.Compare,
+	ORDER_NUMERIC: func(lhv, rhv string) int {
+		if len(lhv) != len(rhv) {
+			return len(lhv) - len(rhv)
+		}
+		return strings.Compare(lhv, rhv)
+	},
+}
+
+// SetOrdering sets the key comparator of the container.
+func (this *Path) SetOrdering(ordering uint8) error {
+	if _, ok := orderings[ordering]; !ok {
+		return errors.New("Error: Unknown key ordering!")
+	}
+	this.Ordering = ordering
+	return nil
+}
+
+// Compare compares two keys with the comparator of the container.
+func (this *Path) Compare(lhv, rhv string) int {
+	if cmp, ok := orderings[this.Ordering]; ok {
+		return cmp(lhv, rhv)
+	}
+	return strings.Compare(lhv, rhv)
+}
+
+// The committed keys sorted by the ordering of the container. They only change when the
+// generations are applied, so they are sorted once and kept until then.
+type sortedKeys struct {
+	committed *orderedset.OrderedSet[string]
+	length    int
+	ordering  uint8
+	keys      []string
+}
+
+// SortedKeys returns the keys in the order of the container. The elements are from the current view
+// of the container, which includes the uncommitted adds and removes in the current generation.
+func (this *Path) SortedKeys() []string {
+	keys := []string{}
+	this.walk(nil, false, func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// Min returns the smallest key in the container.
+func (this *Path) Min() (string, bool) { return this.Nth(0, false) }
+
+// Max returns the largest key in the container.
+func (this *Path) Max() (string, bool) { return this.Nth(0, true) }
+
+// Nth returns the key at the position in the order of the container, or in the reverse order.
+func (this *Path) Nth(idx uint64, reverse bool) (string, bool) {
+	found, ok := "", false
+	this.walk(nil, reverse, func(k string) bool {
+		if idx == 0 {
+			found, ok = k, true
+			return false
+		}
+		idx--
+		return true
+	})
+	return found, ok
+}
+
+// LowerBound returns the smallest key that isn't less than the given key.
+func (this *Path) LowerBound(key string) (string, bool) {
+	return this.first(key, func(k string) bool { return true })
+}
+
+// UpperBound returns the smallest key that is greater than the given key.
+func (this *Path) UpperBound(key string) (string, bool) {
+	return this.first(key, func(k string) bool { return this.Compare(k, key) > 0 })
+}
+
+// Range returns the sorted keys in [from, to). An empty upper bound means no upper bound.
+func (this *Path) Range(from, to string) []string {
+	keys := []string{}
+	this.walk(&from, false, func(k string) bool {
+		if len(to) > 0 && this.Compare(k, to) >= 0 {
+			return false
+		}
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// The smallest key from the given one on satisfying the condition.
+func (this *Path) first(from string, cond func(string) bool) (string, bool) {
+	found, ok := "", false
+	this.walk(&from, false, func(k string) bool {
+		found, ok = k, cond(k)
+		return !ok
+	})
+	return found, ok
+}
+
+// Walk the keys in the order of the container, or in the reverse order, from the first key not less than
+// the given one, or not greater than it in the reverse order. The sorted committed keys are merged with the
+// keys added in the current generation, which are usually a few, so only they are sorted on each call.
+// The walk stops when the visit function returns false.
+func (this *Path) walk(from *string, reverse bool, visit func(string) bool) {
+	committed := this.sortedCommitted()
+	added, lookup := this.sortedAdded()
+
+	start := func(keys []string) int {
+		if from == nil {
+			return common.IfThen(reverse, len(keys)-1, 0)
+		}
+
+		idx, found := slices.BinarySearchFunc(keys, *from, this.Compare)
+		if reverse && !found {
+			return idx - 1
+		}
+		return idx
+	}
+
+	step := common.IfThen(reverse, -1, 1)
+	i, j := start(committed), start(added)
+	for {
+		// Skip the committed keys removed in the current generation or added back again.
+		for ; i >= 0 && i < len(committed); i += step {
+			if _, ok := lookup[committed[i]]; !ok {
+				if ok, _ := this.DeltaSet.Exists(committed[i]); ok {
+					break
+				}
+			}
+		}
+
+		inCommitted, inAdded := i >= 0 && i < len(committed), j >= 0 && j < len(added)
+		if !inCommitted && !inAdded {
+			return
+		}
+
+		var key string
+		if inCommitted && (!inAdded || (this.Compare(committed[i], added[j]) < 0) != reverse) {
+			key, i = committed[i], i+step
+		} else {
+			key, j = added[j], j+step
+		}
+
+		if !visit(key) {
+			return
+		}
+	}
+}
+
+// The committed keys in order. Committed paths are shared by the readers of the cache, so the sorted
+// keys are swapped in atomically, two readers racing on the first access only sort them twice.
+func (this *Path) sortedCommitted() []string {
+	committed := this.DeltaSet.Committed()
+	if committed == nil {
+		return nil
+	}
+
+	if cached := this.sorted.Load(); cached != nil && cached.committed == committed && cached.length == int(committed.Length()) && cached.ordering == this.Ordering {
+		return cached.keys
+	}
+
+	keys := slices.Clone(committed.Elements())
+	slices.SortFunc(keys, this.Compare)
+	this.sorted.Store(&sortedKeys{committed: committed, length: int(committed.Length()), ordering: this.Ordering, keys: keys})
+	return keys
+}
+
+// The keys added in the current generation that are still in the container, sorted, and their lookup.
+func (this *Path) sortedAdded() ([]string, map[string]struct{}) {
+	if this.DeltaSet.Added() == nil {
+		return nil, nil
+	}
+
+	keys := slice.CopyIf(this.DeltaSet.Added().Elements(), func(_ int, k string) bool {
+		ok, _ := this.DeltaSet.Exists(k)
+		return ok
+	})
+	slices.SortFunc(keys, this.Compare)
+
+	lookup := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		lookup[k] = struct{}{}
+	}
+	return keys, lookup
+}
@@ -18,8 +18,11 @@
 package commutative
 
 import (
+	"slices"
+	"sync"
 	"testing"
 
+	codec "github.com/arcology-network/common-lib/codec"
 	"github.com/arcology-network/common-lib/exp/orderedset"
 	"github.com/arcology-network/common-lib/exp/slice"
 )
@@ -133,3 +136,178 @@ func TestCodecPathMeta(t *testing.T) {
 		t.Error("Error: Don't match!!", out.Removed())
 	}
 }
+
+type pathStore map[string]*Path
+
+func (this pathStore) Retrive(key string, _ any) (any, error) {
+	if v, ok := this[key]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+func TestPathCascadeSub(t *testing.T) {
+	root := "blcc://eth1.0/account/alice/storage/container/ctrn-0/"
+	store := pathStore{
+		root + "sub/":     NewPath("e-11", "e-12").(*Path),
+		root + "sub/sub/": NewPath("e-21").(*Path),
+	}
+
+	subs := NewPath("e-01", "sub/").(*Path).GetCascadeSub(root, store)
+	target := []string{
+		root + "e-01",
+		root + "sub/",
+		root + "sub/e-11",
+		root + "sub/e-12",
+	}
+
+	if !slice.EqualSet(subs, target) {
+		t.Error("Error: Wrong cascade sub paths", subs)
+	}
+
+	store[root+"sub/"] = NewPath("e-11", "sub/").(*Path)
+	subs = NewPath("sub/").(*Path).GetCascadeSub(root, store)
+	if !slice.EqualSet(subs, []string{root + "sub/", root + "sub/e-11", root + "sub/sub/", root + "sub/sub/e-21"}) {
+		t.Error("Error: Wrong nested cascade sub paths", subs)
+	}
+}
+
+func TestPathOrdering(t *testing.T) {
+	path := NewPath().(*Path)
+	path.SetSubPaths([]string{"30", "100", "7"})
+	path.SetAdded([]string{"9", "25"})
+	path.InsertRemoved([]string{"7"})
+
+	if keys := path.SortedKeys(); !slices.Equal(keys, []string{"100", "25", "30", "9"}) {
+		t.Error("Error: Wrong lexical order", keys)
+	}
+
+	if path.SetOrdering(255) == nil {
+		t.Error("Error: Should have failed with an unknown ordering")
+	}
+
+	path.SetOrdering(ORDER_NUMERIC)
+	if keys := path.SortedKeys(); !slices.Equal(keys, []string{"9", "25", "30", "100"}) {
+		t.Error("Error: Wrong numeric order", keys)
+	}
+
+	if v, ok := path.Min(); !ok || v != "9" {
+		t.Error("Error: Wrong min", v)
+	}
+
+	if v, ok := path.Max(); !ok || v != "100" {
+		t.Error("Error: Wrong max", v)
+	}
+
+	if v, ok := path.LowerBound("25"); !ok || v != "25" {
+		t.Error("Error: Wrong lower bound", v)
+	}
+
+	if v, ok := path.UpperBound("25"); !ok || v != "30" {
+		t.Error("Error: Wrong upper bound", v)
+	}
+
+	if v, ok := path.UpperBound("100"); ok {
+		t.Error("Error: Should have no upper bound", v)
+	}
+
+	if keys := path.Range("10", "100"); !slices.Equal(keys, []string{"25", "30"}) {
+		t.Error("Error: Wrong range", keys)
+	}
+
+	out := (&Path{}).Decode(path.Encode()).(*Path)
+	if out.Ordering != ORDER_NUMERIC {
+		t.Error("Error: The ordering should have been encoded", out.Ordering)
+	}
+}
+
+func TestPathOrderedView(t *testing.T) {
+	path := NewPath().(*Path)
+	path.SetOrdering(ORDER_NUMERIC)
+	path.SetSubPaths([]string{"30", "100", "7", "1"})
+
+	if v, ok := path.Nth(1, false); !ok || v != "7" {
+		t.Error("Error: Wrong second smallest", v)
+	}
+
+	// The committed keys are sorted once, the later adds and removes are merged on the fly.
+	sorted := path.sorted.Load()
+	path.SetAdded([]string{"9", "250"})
+	path.InsertRemoved([]string{"1", "100"})
+	if keys := path.SortedKeys(); !slices.Equal(keys, []string{"7", "9", "30", "250"}) || path.sorted.Load() != sorted {
+		t.Error("Error: Wrong order", keys)
+	}
+
+	if v, ok := path.Nth(1, true); !ok || v != "30" {
+		t.Error("Error: Wrong second largest", v)
+	}
+
+	if keys := path.Range("8", ""); !slices.Equal(keys, []string{"9", "30", "250"}) {
+		t.Error("Error: Wrong range", keys)
+	}
+
+	if _, ok := path.Nth(4, false); ok {
+		t.Error("Error: Out of range")
+	}
+
+	path.SetSubPaths([]string{"5"})
+	if v, ok := path.Min(); !ok || v != "5" || path.sorted.Load() == sorted {
+		t.Error("Error: The committed keys should have been sorted again", v)
+	}
+}
+
+// The committed paths are read by many goroutines, the first ordered accesses race to sort the keys.
+func TestPathConcurrentOrder(t *testing.T) {
+	path := NewPath().(*Path)
+	path.SetSubPaths([]string{"c", "a", "d", "b"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if keys := path.SortedKeys(); !slices.Equal(keys, []string{"a", "b", "c", "d"}) {
+				t.Error("Error: Wrong order", keys)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sorted := path.sorted.Load(); sorted == nil || !slices.Equal(sorted.keys, []string{"a", "b", "c", "d"}) {
+		t.Error("Error: The sorted keys should have been kept")
+	}
+}
+
+// Encode the path in the layout before the codec was versioned.
+func encodePathV0(path *Path) []byte {
+	buffer := make([]byte, 5*codec.UINT64_LEN+8+1+uint64(path.DeltaSet.Size())+1)
+	offset := codec.Encoder{}.FillHeader(buffer, []uint64{8, 1, uint64(path.DeltaSet.Size()), 1})
+	offset += codec.Uint64(path.TotalSize).EncodeTo(buffer[offset:])
+	offset += codec.Bool(path.isBlockBound).EncodeTo(buffer[offset:])
+	path.DeltaSet.EncodeTo(buffer[offset:])
+	buffer[offset+int(path.DeltaSet.Size())] = path.ElemType
+	return buffer
+}
+
+func TestPathCodecV0(t *testing.T) {
+	in := NewPath().(*Path)
+	in.TotalSize = 111
+	in.ElemType = 3
+	in.SetSubPaths([]string{"e-01", "e-001"})
+	in.SetAdded([]string{"+01"})
+
+	out := (&Path{}).Decode(encodePathV0(in)).(*Path)
+	if out.TotalSize != in.TotalSize || out.ElemType != in.ElemType || out.Ordering != ORDER_LEXICAL {
+		t.Error("Error: Wrong fields", out.TotalSize, out.ElemType, out.Ordering)
+	}
+
+	if !slice.EqualSet(out.DeltaSet.Added().Elements(), []string{"+01"}) {
+		t.Error("Error: Don't match!!", out.Added())
+	}
+
+	// Encoded with the current version from now on.
+	in.SetOrdering(ORDER_NUMERIC)
+	if out = (&Path{}).Decode(in.Encode()).(*Path); out.Ordering != ORDER_NUMERIC || out.ElemType != in.ElemType {
+		t.Error("Error: Wrong fields", out.Ordering, out.ElemType)
+	}
+}
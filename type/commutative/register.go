@@ -0,0 +1,244 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/arcology-network/common-lib/common"
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	uint256 "github.com/holiman/uint256"
+)
+
+// register keeps the extreme of all the values written to it, the maximum for a MaxRegister and
+// the minimum for a MinRegister. Keeping the extreme is commutative, so the writes from different
+// transactions never conflict and their deltas are merged in any order. Good for high-water marks
+// like the best bid or the latest timestamp.
+type register struct {
+	value    uint256.Int // The committed extreme
+	delta    uint256.Int // The extreme written in the current generation
+	hasValue bool
+	hasDelta bool
+	keepMax  bool
+}
+
+func (this *register) IsNumeric() bool     { return true }
+func (this *register) IsCommutative() bool { return true }
+func (this *register) Limits() (any, any)  { return nil, nil }
+
+func (this *register) Value() any {
+	return common.IfThenDo1st(this.hasValue, func() any { return this.value }, nil)
+}
+
+func (this *register) Delta() (any, bool)      { return this.delta, this.hasDelta }
+func (this *register) CloneDelta() (any, bool) { return *this.delta.Clone(), this.hasDelta }
+func (this *register) Preload(_ string, _ any) {}
+
+func (this *register) SetValue(v any) {
+	this.hasValue = v != nil
+	this.value = common.IfThenDo1st(v != nil, func() uint256.Int { return v.(uint256.Int) }, uint256.Int{})
+}
+
+func (this *register) SetDelta(v any, hasDelta bool) {
+	this.delta = v.(uint256.Int)
+	this.hasDelta = hasDelta
+}
+
+func (this *register) IsDeltaApplied() bool { return !this.hasDelta }
+func (this *register) ResetDelta()          { this.delta, this.hasDelta = uint256.Int{}, false }
+
+func (this *register) MemSize() uint64                            { return 2*32 + 3 } // in bytes
+func (this *register) IsDeletable(key, path any) bool             { return true }
+func (this *register) CopyTo(v any) (any, uint32, uint32, uint32) { return v, 0, 1, 0 }
+func (*register) GetCascadeSub(_ string, _ any) []string          { return nil }
+func (this *register) ShortHash() (uint64, bool)                  { return 0, false }
+
+func (this *register) equal(other *register) bool {
+	return this.value.Eq(&other.value) && this.delta.Eq(&other.delta) &&
+		this.hasValue == other.hasValue && this.hasDelta == other.hasDelta
+}
+
+// Check if the lhv is more extreme than the rhv.
+func (this *register) better(lhv, rhv *uint256.Int) bool {
+	return common.IfThen(this.keepMax, lhv.Gt(rhv), lhv.Lt(rhv))
+}
+
+// Get returns the extreme of the committed value and the delta, zero if nothing has been written yet.
+func (this *register) Get() (any, uint32, uint32) {
+	if !this.hasDelta {
+		return this.value, 1, 0
+	}
+
+	if this.hasValue && !this.better(&this.delta, &this.value) {
+		return this.value, 1, 1
+	}
+	return this.delta, 1, 1
+}
+
+// Keep the more extreme of the values written to the other register in the delta.
+func (this *register) merge(other *register) {
+	for _, candidate := range []struct {
+		v  *uint256.Int
+		ok bool
+	}{{&other.value, other.hasValue}, {&other.delta, other.hasDelta}} {
+		if candidate.ok && (!this.hasDelta || this.better(candidate.v, &this.delta)) {
+			this.delta, this.hasDelta = *candidate.v, true
+		}
+	}
+}
+
+// Move the extreme into the committed value.
+func (this *register) commit() {
+	if v, _, _ := this.Get(); this.hasValue || this.hasDelta {
+		this.value, this.hasValue = v.(uint256.Int), true
+	}
+	this.ResetDelta()
+}
+
+func (this *register) Print() {
+	fmt.Println(" Value: ", this.value, "Has Value: ", this.hasValue, " Delta: ", this.delta, "Has Delta: ", this.hasDelta)
+}
+
+// MaxRegister keeps the maximum of all the values written to it.
+type MaxRegister struct{ register }
+
+func NewMaxRegister() stgcommon.Type { return &MaxRegister{register{keepMax: true}} }
+
+// NewMaxRegisterDelta creates the delta to write to a MaxRegister, it only takes effect if v is greater than the current value.
+func NewMaxRegisterDelta(v *uint256.Int) stgcommon.Type {
+	return &MaxRegister{register{delta: *v, hasDelta: true, keepMax: true}}
+}
+
+// For the codec only, don't use it for other purposes
+func (this *MaxRegister) New(value, delta, sign, _, _ any) any {
+	return &MaxRegister{newRegister(value, delta, sign, true)}
+}
+
+func (this *MaxRegister) Clone() any           { return &MaxRegister{this.register} }
+func (this *MaxRegister) Equal(other any) bool { return this.equal(&other.(*MaxRegister).register) }
+func (this *MaxRegister) TypeID() uint8        { return MAX_REGISTER }
+func (this *MaxRegister) Hash() [32]byte       { return sha256.Sum256(this.Encode()) }
+
+func (this *MaxRegister) Set(v any, source any) (any, uint32, uint32, uint32, error) {
+	if v == nil {
+		return this, 0, 1, 0, nil
+	}
+
+	other, ok := v.(*MaxRegister)
+	if !ok {
+		return this, 0, 1, 0, errors.New("Error: Not a MaxRegister")
+	}
+
+	this.merge(&other.register)
+	return this, 0, 0, 1, nil
+}
+
+func (this *MaxRegister) ApplyDelta(typedVals []stgcommon.Type) (stgcommon.Type, int, error) {
+	for i, v := range typedVals {
+		if this == nil && v != nil { // New value
+			this = v.(*MaxRegister)
+		}
+
+		if this != nil && v != nil {
+			if _, _, _, _, err := this.Set(v, nil); err != nil {
+				return nil, i, err
+			}
+		}
+
+		if this != nil && v == nil {
+			this = nil
+		}
+	}
+
+	if this == nil {
+		return nil, 0, errors.New("Error: Nil value")
+	}
+
+	this.commit()
+	return this, len(typedVals), nil
+}
+
+// MinRegister keeps the minimum of all the values written to it.
+type MinRegister struct{ register }
+
+func NewMinRegister() stgcommon.Type { return &MinRegister{register{keepMax: false}} }
+
+// NewMinRegisterDelta creates the delta to write to a MinRegister, it only takes effect if v is less than the current value.
+func NewMinRegisterDelta(v *uint256.Int) stgcommon.Type {
+	return &MinRegister{register{delta: *v, hasDelta: true, keepMax: false}}
+}
+
+// For the codec only, don't use it for other purposes
+func (this *MinRegister) New(value, delta, sign, _, _ any) any {
+	return &MinRegister{newRegister(value, delta, sign, false)}
+}
+
+func (this *MinRegister) Clone() any           { return &MinRegister{this.register} }
+func (this *MinRegister) Equal(other any) bool { return this.equal(&other.(*MinRegister).register) }
+func (this *MinRegister) TypeID() uint8        { return MIN_REGISTER }
+func (this *MinRegister) Hash() [32]byte       { return sha256.Sum256(this.Encode()) }
+
+func (this *MinRegister) Set(v any, source any) (any, uint32, uint32, uint32, error) {
+	if v == nil {
+		return this, 0, 1, 0, nil
+	}
+
+	other, ok := v.(*MinRegister)
+	if !ok {
+		return this, 0, 1, 0, errors.New("Error: Not a MinRegister")
+	}
+
+	this.merge(&other.register)
+	return this, 0, 0, 1, nil
+}
+
+func (this *MinRegister) ApplyDelta(typedVals []stgcommon.Type) (stgcommon.Type, int, error) {
+	for i, v := range typedVals {
+		if this == nil && v != nil { // New value
+			this = v.(*MinRegister)
+		}
+
+		if this != nil && v != nil {
+			if _, _, _, _, err := this.Set(v, nil); err != nil {
+				return nil, i, err
+			}
+		}
+
+		if this != nil && v == nil {
+			this = nil
+		}
+	}
+
+	if this == nil {
+		return nil, 0, errors.New("Error: Nil value")
+	}
+
+	this.commit()
+	return this, len(typedVals), nil
+}
+
+func newRegister(value, delta, hasDelta any, keepMax bool) register {
+	reg := register{keepMax: keepMax}
+	reg.SetValue(value)
+	if delta != nil {
+		reg.SetDelta(delta, hasDelta == nil || hasDelta.(bool))
+	}
+	return reg
+}
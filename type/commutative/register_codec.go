@@ -0,0 +1,108 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	codec "github.com/arcology-network/common-lib/codec"
+	"github.com/arcology-network/common-lib/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func (this *register) HeaderSize() uint64 {
+	return 2 // Total number of fields
+}
+
+func (this *register) Size() uint64 {
+	return this.HeaderSize() +
+		common.IfThen(this.hasValue, uint64(32), 0) + // Values
+		common.IfThen(this.hasDelta, uint64(32), 0) // delta
+}
+
+func (this *register) Encode() []byte {
+	buffer := make([]byte, this.Size())
+	buffer[0] = common.IfThen(this.hasValue, uint8(32), 0)
+	buffer[1] = common.IfThen(this.hasDelta, uint8(32), 0)
+
+	this.EncodeTo(buffer[2:])
+	return buffer
+}
+
+func (this *register) EncodeTo(buffer []byte) int {
+	offset := common.IfThenDo1st(this.hasValue, func() int { return codec.Uint64s(this.value[:]).EncodeTo(buffer) }, 0)
+	offset += common.IfThenDo1st(this.hasDelta, func() int { return codec.Uint64s(this.delta[:]).EncodeTo(buffer[offset:]) }, 0)
+	return offset
+}
+
+func (this *register) decode(buffer []byte) {
+	if len(buffer) == 0 {
+		return
+	}
+
+	offset := 2
+	if this.hasValue = buffer[0] > 0; this.hasValue {
+		copy(this.value[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+		offset += int(buffer[0])
+	}
+
+	if this.hasDelta = buffer[1] > 0; this.hasDelta {
+		copy(this.delta[:], codec.Uint64s{}.Decode(buffer[offset:]).(codec.Uint64s))
+	}
+}
+
+// Only the committed value is persisted, an empty list if nothing has been written to the register.
+func (this *register) StorageEncode(_ string) []byte {
+	values := [][]byte{}
+	if this.hasValue {
+		values = append(values, this.value.Bytes())
+	}
+
+	buffer, _ := rlp.EncodeToBytes(values)
+	return buffer
+}
+
+func (this *register) storageDecode(buffer []byte) {
+	var values [][]byte
+	if err := rlp.DecodeBytes(buffer, &values); err == nil && len(values) > 0 {
+		this.value.SetBytes(values[0])
+		this.hasValue = true
+	}
+}
+
+func (*MaxRegister) Decode(buffer []byte) any {
+	this := NewMaxRegister().(*MaxRegister)
+	this.decode(buffer)
+	return this
+}
+
+func (*MaxRegister) StorageDecode(_ string, buffer []byte) any {
+	this := NewMaxRegister().(*MaxRegister)
+	this.storageDecode(buffer)
+	return this
+}
+
+func (*MinRegister) Decode(buffer []byte) any {
+	this := NewMinRegister().(*MinRegister)
+	this.decode(buffer)
+	return this
+}
+
+func (*MinRegister) StorageDecode(_ string, buffer []byte) any {
+	this := NewMinRegister().(*MinRegister)
+	this.storageDecode(buffer)
+	return this
+}
@@ -0,0 +1,82 @@
+/*
+ *   Copyright (c) 2025 Arcology Network
+
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package commutative
+
+import (
+	"testing"
+
+	stgcommon "github.com/arcology-network/storage-committer/common"
+	"github.com/holiman/uint256"
+)
+
+func TestMaxRegister(t *testing.T) {
+	v := NewMaxRegister().(*MaxRegister)
+	v.Set(NewMaxRegisterDelta(uint256.NewInt(5)), nil)
+	v.Set(NewMaxRegisterDelta(uint256.NewInt(9)), nil)
+	v.Set(NewMaxRegisterDelta(uint256.NewInt(7)), nil)
+
+	if final, _, _ := v.Get(); final.(uint256.Int).Uint64() != 9 {
+		t.Error("Error: Wrong value", final)
+	}
+
+	// The deltas of the transactions are merged in any order.
+	v.ApplyDelta(nil)
+	merged, _, err := v.ApplyDelta([]stgcommon.Type{NewMaxRegisterDelta(uint256.NewInt(3)), NewMaxRegisterDelta(uint256.NewInt(12))})
+	if final, _, _ := merged.Get(); err != nil || final.(uint256.Int).Uint64() != 12 || !merged.IsDeltaApplied() {
+		t.Error("Error: Wrong value", final, err)
+	}
+
+	if merged, _, _ = merged.ApplyDelta([]stgcommon.Type{NewMaxRegisterDelta(uint256.NewInt(10))}); merged.Value().(uint256.Int).Uint64() != 12 {
+		t.Error("Error: A smaller value shouldn't replace the maximum", merged.Value())
+	}
+}
+
+func TestMinRegister(t *testing.T) {
+	v := NewMinRegister().(*MinRegister)
+	if v.Value() != nil {
+		t.Error("Error: Should be empty")
+	}
+
+	merged, _, err := v.ApplyDelta([]stgcommon.Type{NewMinRegisterDelta(uint256.NewInt(8)), NewMinRegisterDelta(uint256.NewInt(0)), NewMinRegisterDelta(uint256.NewInt(4))})
+	if err != nil || merged.Value().(uint256.Int).Uint64() != 0 {
+		t.Error("Error: Wrong value", merged.Value(), err)
+	}
+
+	if _, _, err := merged.ApplyDelta([]stgcommon.Type{nil}); err == nil {
+		t.Error("Error: The register should have been deleted")
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	v := NewMaxRegister().(*MaxRegister)
+	v.ApplyDelta([]stgcommon.Type{NewMaxRegisterDelta(uint256.NewInt(42))})
+	v.Set(NewMaxRegisterDelta(uint256.NewInt(43)), nil)
+
+	if decoded := (&MaxRegister{}).Decode(v.Encode()).(*MaxRegister); !decoded.Equal(v) {
+		t.Error("Error: Mismatched")
+	}
+
+	stored := (&MaxRegister{}).StorageDecode("", v.StorageEncode("")).(*MaxRegister)
+	if stored.Value().(uint256.Int).Uint64() != 42 || !stored.IsDeltaApplied() {
+		t.Error("Error: Only the committed value should be persisted", stored.Value())
+	}
+
+	if empty := (&MinRegister{}).StorageDecode("", NewMinRegister().StorageEncode("")).(*MinRegister); empty.Value() != nil {
+		t.Error("Error: Should be empty", empty.Value())
+	}
+}
@@ -212,6 +212,12 @@ func (this *U256) Get() (any, uint32, uint32) {
 }
 
 func (this *U256) isOverflowed(lhv *uint256.Int, lhvSign bool, rhv *uint256.Int, rhvSign bool) (*uint256.Int, bool) {
+	return addSignMagnitude(lhv, lhvSign, rhv, rhvSign)
+}
+
+// Add two numbers in the sign-magnitude form. It returns the absolute value and the sign of the sum,
+// or nil if the absolute value overflows.
+func addSignMagnitude(lhv *uint256.Int, lhvSign bool, rhv *uint256.Int, rhvSign bool) (*uint256.Int, bool) {
 	if lhvSign == rhvSign { // Both positive or negative
 		summed, overflowed := (*uint256.Int)(lhv).AddOverflow(lhv, (*uint256.Int)(rhv))
 		if overflowed {
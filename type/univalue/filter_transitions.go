@@ -52,9 +52,9 @@ func (this IPTransition) From(v *Univalue) *Univalue {
 
 	min, max := typed.Limits()
 	vtyped := typed.New(
-		common.IfThen(!v.Value().(stgcommon.Type).IsCommutative() || common.IsType[*commutative.Path](v.Value()),
+		common.IfThen(!v.Value().(stgcommon.Type).IsCommutative() || common.IsType[*commutative.Path](v.Value()) || common.IsType[*commutative.GrowOnlySet](v.Value()),
 			nil,
-			v.Value().(stgcommon.Type).Value()), // Keep Non-path commutative variables (u256, u64) only
+			v.Value().(stgcommon.Type).Value()), // Keep Non-path commutative variables (u256, u64) only, a set only needs the elements added
 		delta,
 		sign,
 		min,
@@ -288,7 +288,8 @@ func (this *Univalue) IsNilInitOnly() bool {
 }
 
 // Commutative write is no longer treated as a conflict with read.
-// Write without read happens when a new value is created.
+// Write without read happens when a new value is created. The numeric commutative types include the
+// counters merged by addition and the registers merged by keeping the extreme, like the MaxRegister.
 func (this *Univalue) IsCumulativeWriteOnly(other *Univalue) bool {
 	if this.Value() == nil {
 		return false
@@ -299,6 +300,7 @@ func (this *Univalue) IsCumulativeWriteOnly(other *Univalue) bool {
 	return this.reads == 0 &&
 		this.Value().(intf.Type).IsCommutative() &&
 		this.Value().(intf.Type).IsNumeric() &&
+		this.Value().(intf.Type).TypeID() == other.Value().(intf.Type).TypeID() && // A max register doesn't merge with a min one.
 		min == otherMin &&
 		max == otherMax &&
 		this.Reads() == 0